@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+// runBatch implements `cozyvalues-gen batch [flags] DIR|GLOB ...`: every chart
+// (a directory with Chart.yaml and values.yaml) below the given roots is
+// generated by a bounded pool of workers. It returns the process exit code.
+func runBatch(args []string) int {
+	fs := pflag.NewFlagSet("batch", pflag.ContinueOnError)
+	var (
+		o    options
+		tmpl job
+	)
+	addOptionFlags(fs, &o)
+	fs.StringVarP(&tmpl.outGo, "debug-go", "g", "", "Go output, relative to each chart")
+	fs.StringVarP(&tmpl.outCRD, "debug-crd", "c", "", "CRD output, relative to each chart")
+	fs.StringVarP(&tmpl.outSchema, "schema", "s", "values.schema.json", "values.schema.json output, relative to each chart")
+	fs.StringVarP(&tmpl.outReadme, "readme", "r", "README.md", "README to update, relative to each chart; skipped when the chart has none")
+	jobs := fs.IntP("jobs", "j", runtime.NumCPU(), "number of charts processed in parallel")
+	if err := fs.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "batch: no chart root or glob given")
+		return 2
+	}
+
+	charts, err := findCharts(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "batch: %v\n", err)
+		return 2
+	}
+	if len(charts) == 0 {
+		fmt.Fprintln(os.Stderr, "batch: no charts found")
+		return 2
+	}
+
+	results := generateAll(fs, &o, charts, tmpl, *jobs)
+
+	var failed, stale int
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.err != nil:
+			status = "FAIL"
+			failed++
+		case !r.upToDate:
+			status = "STALE"
+			stale++
+		}
+		fmt.Printf("==> %s %s\n", status, r.dir)
+		out := r.log.String()
+		if r.err != nil {
+			out += r.err.Error() + "\n"
+		}
+		if out != "" {
+			fmt.Print(indent(out))
+		}
+	}
+	fmt.Printf("%d chart(s): %d ok, %d stale, %d failed\n", len(results), len(results)-failed-stale, stale, failed)
+	if failed > 0 || stale > 0 {
+		return 1
+	}
+	return 0
+}
+
+type chartResult struct {
+	dir      string
+	log      bytes.Buffer
+	upToDate bool
+	err      error
+}
+
+// generateAll runs generate for every chart directory with at most workers
+// charts in flight. Results keep the order of charts.
+func generateAll(flags *pflag.FlagSet, o *options, charts []string, tmpl job, workers int) []*chartResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]*chartResult, len(charts))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = generateChart(flags, o, charts[i], tmpl)
+			}
+		}()
+	}
+	for i := range charts {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// generateChart resolves the output paths of tmpl against dir, applies the
+// chart's configuration file and runs generate.
+func generateChart(flags *pflag.FlagSet, o *options, dir string, tmpl job) *chartResult {
+	r := &chartResult{dir: dir}
+	co := *o
+	rel := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	j := job{
+		values:    filepath.Join(dir, "values.yaml"),
+		outGo:     rel(tmpl.outGo),
+		outCRD:    rel(tmpl.outCRD),
+		outSchema: rel(tmpl.outSchema),
+		outReadme: rel(tmpl.outReadme),
+	}
+	if r.err = applyConfig(flags, &co, &j, dir); r.err != nil {
+		r.err = fmt.Errorf("config: %w", r.err)
+		return r
+	}
+	if _, err := os.Stat(j.outReadme); j.outReadme != "" && errors.Is(err, fs.ErrNotExist) {
+		j.outReadme = ""
+	}
+	r.upToDate, r.err = generate(&co, j, &r.log)
+	return r
+}
+
+// findCharts expands roots (directories or globs) into the sorted list of
+// chart directories below them. A chart's own subdirectories, such as
+// vendored subcharts in charts/, are not searched.
+func findCharts(roots []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, root := range roots {
+		matches := []string{root}
+		if strings.ContainsAny(root, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(root); err != nil {
+				return nil, fmt.Errorf("%s: %w", root, err)
+			}
+		}
+		for _, m := range matches {
+			err := filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					return nil
+				}
+				if !isChart(path) {
+					return nil
+				}
+				if !seen[path] {
+					seen[path] = true
+					out = append(out, path)
+				}
+				return filepath.SkipDir
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func isChart(dir string) bool {
+	for _, f := range []string{"Chart.yaml", "values.yaml"} {
+		if st, err := os.Stat(filepath.Join(dir, f)); err != nil || st.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+func indent(s string) string {
+	lines := strings.SplitAfter(strings.TrimRight(s, "\n"), "\n")
+	return "    " + strings.Join(lines, "    ") + "\n"
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/cozystack/cozyvalues-gen/internal/config"
+	"github.com/spf13/pflag"
+)
+
+// applyConfig merges the .cozyvalues-gen.yaml settings for the chart in dir
+// into o and j. Flags set explicitly on fs take precedence; output paths from
+// the file are relative to dir.
+func applyConfig(fs *pflag.FlagSet, o *options, j *job, dir string) error {
+	f, err := config.Discover(dir)
+	if err != nil || f == nil {
+		return err
+	}
+	s := f.For(dir)
+
+	str := func(flag string, dst, v *string) {
+		if v != nil && !fs.Changed(flag) {
+			*dst = *v
+		}
+	}
+	str("module", &o.module, s.Module)
+	str("group-name", &o.groupName, s.GroupName)
+	str("version-name", &o.versionName, s.VersionName)
+
+	out := func(flag string, dst, v *string) {
+		if v == nil || fs.Changed(flag) {
+			return
+		}
+		*dst = *v
+		if *v != "" && !filepath.IsAbs(*v) {
+			*dst = filepath.Join(dir, *v)
+		}
+	}
+	out("debug-go", &j.outGo, s.Outputs.Go)
+	out("debug-crd", &j.outCRD, s.Outputs.CRD)
+	out("schema", &j.outSchema, s.Outputs.Schema)
+	out("readme", &j.outReadme, s.Outputs.Readme)
+
+	o.allowTags = append(append([]string(nil), o.allowTags...), s.AllowTags...)
+	o.typeAliases = s.Types
+	if s.OptionalByDefault != nil && !fs.Changed("optional-by-default") {
+		o.optional = *s.OptionalByDefault
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// emit writes data to path and reports it to w with verb. In check mode
+// nothing is written; a stale or missing file is reported with a unified diff
+// and emit returns false. A file that cannot be written or read is an error.
+func emit(w io.Writer, check bool, path string, data []byte, verb string) (bool, error) {
+	if !check {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return false, fmt.Errorf("%s: %w", verb, err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return false, fmt.Errorf("%s: %w", verb, err)
+		}
+		fmt.Fprintf(w, "%s: %s\n", verb, path)
+		return true, nil
+	}
+
+	old, err := os.ReadFile(path)
+	from := path
+	if errors.Is(err, fs.ErrNotExist) {
+		from = "/dev/null"
+	} else if err != nil {
+		return false, fmt.Errorf("check: %w", err)
+	}
+	if bytes.Equal(old, data) {
+		fmt.Fprintf(w, "up to date: %s\n", path)
+		return true, nil
+	}
+
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(old)),
+		B:        difflib.SplitLines(string(data)),
+		FromFile: from,
+		ToFile:   path + " (generated)",
+		Context:  3,
+	})
+	fmt.Fprintf(w, "stale: %s\n%s", path, diff)
+	return false, nil
+}
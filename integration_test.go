@@ -1,24 +1,32 @@
 package main
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/cozystack/cozyvalues-gen/pkg/cozyvalues"
 	"github.com/stretchr/testify/require"
 )
 
-// TestCLIGenerationWorkflow tests the complete CLI workflow
-func TestCLIGenerationWorkflow(t *testing.T) {
-	// Build the binary in a temporary directory
-	testDir := t.TempDir()
-	binaryPath := filepath.Join(testDir, "cozyvalues-gen-test")
+// buildBinary builds the CLI into a temporary directory
+func buildBinary(t *testing.T) string {
+	t.Helper()
+	binaryPath := filepath.Join(t.TempDir(), "cozyvalues-gen-test")
 
 	buildCmd := exec.Command("go", "build", "-o", binaryPath)
 	buildCmd.Dir = "."
 	output, err := buildCmd.CombinedOutput()
 	require.NoError(t, err, "failed to build: %s", string(output))
+	return binaryPath
+}
+
+// TestCLIGenerationWorkflow tests the complete CLI workflow
+func TestCLIGenerationWorkflow(t *testing.T) {
+	binaryPath := buildBinary(t)
 
 	// Test on each example
 	examples := []string{"monitoring.yaml", "postgres.yaml", "virtual-machine.yaml"}
@@ -52,6 +60,228 @@ func TestCLIGenerationWorkflow(t *testing.T) {
 			require.NotEmpty(t, schemaData, "generated schema should not be empty")
 			require.Contains(t, string(schemaData), `"title": "Chart Values"`, "schema should have title")
 			require.Contains(t, string(schemaData), `"properties"`, "schema should have properties")
+
+			// The controller-gen pipeline must render the same schema
+			cgSchemaOut := filepath.Join(tmpDir, "values.cg.schema.json")
+			cmd = exec.Command(binaryPath, "-v", examplePath, "-s", cgSchemaOut, "--controller-gen")
+			output, err = cmd.CombinedOutput()
+			require.NoError(t, err, "controller-gen pipeline failed for %s: %s", example, string(output))
+			cgSchemaData, err := os.ReadFile(cgSchemaOut)
+			require.NoError(t, err, "failed to read controller-gen schema file")
+			require.Equal(t, string(cgSchemaData), string(schemaData), "native and controller-gen schemas should match")
+
+			// The library renders the same files as the CLI
+			values, err := os.ReadFile(examplePath)
+			require.NoError(t, err)
+			v, err := cozyvalues.Parse(values, cozyvalues.Options{Filename: examplePath})
+			require.NoError(t, err)
+			libGo, err := v.GoTypes()
+			require.NoError(t, err)
+			require.Equal(t, string(goData), string(libGo), "library and CLI Go code should match")
+			libSchema, err := v.Schema()
+			require.NoError(t, err)
+			require.Equal(t, string(schemaData), string(libSchema), "library and CLI schemas should match")
 		})
 	}
 }
+
+// TestCLICheckMode verifies that --check reports stale outputs without writing them
+func TestCLICheckMode(t *testing.T) {
+	binaryPath := buildBinary(t)
+	tmpDir := t.TempDir()
+
+	values, err := os.ReadFile(filepath.Join("examples", "postgres.yaml"))
+	require.NoError(t, err)
+	valuesPath := filepath.Join(tmpDir, "values.yaml")
+	require.NoError(t, os.WriteFile(valuesPath, values, 0o644))
+	readmePath := filepath.Join(tmpDir, "README.md")
+	require.NoError(t, os.WriteFile(readmePath, []byte("# Chart\n\n## Parameters\n\nold\n"), 0o644))
+
+	args := []string{
+		"-v", valuesPath,
+		"-g", filepath.Join(tmpDir, "types.go"),
+		"-s", filepath.Join(tmpDir, "values.schema.json"),
+		"-c", filepath.Join(tmpDir, "crd.yaml"),
+		"-r", readmePath,
+	}
+
+	// Missing outputs are stale and must not be created
+	output, err := exec.Command(binaryPath, append([]string{"--check"}, args...)...).CombinedOutput()
+	require.Error(t, err, "check should fail: %s", string(output))
+	require.Contains(t, string(output), "+++ "+filepath.Join(tmpDir, "types.go")+" (generated)")
+	_, err = os.Stat(filepath.Join(tmpDir, "types.go"))
+	require.True(t, os.IsNotExist(err), "check must not write files")
+
+	output, err = exec.Command(binaryPath, args...).CombinedOutput()
+	require.NoError(t, err, "generation failed: %s", string(output))
+
+	output, err = exec.Command(binaryPath, append([]string{"--check"}, args...)...).CombinedOutput()
+	require.NoError(t, err, "fresh outputs should pass: %s", string(output))
+
+	// A changed description makes every artifact stale
+	changed := strings.Replace(string(values), "Determines the maximum", "Sets the max", 1)
+	require.NoError(t, os.WriteFile(valuesPath, []byte(changed), 0o644))
+	before, err := os.ReadFile(readmePath)
+	require.NoError(t, err)
+
+	output, err = exec.Command(binaryPath, append([]string{"--check"}, args...)...).CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "stale: "+readmePath)
+	require.Contains(t, string(output), "-              \"description\": \"Determines the maximum")
+	require.Contains(t, string(output), "+              \"description\": \"Sets the max")
+
+	after, err := os.ReadFile(readmePath)
+	require.NoError(t, err)
+	require.Equal(t, string(before), string(after), "check must leave the README untouched")
+}
+
+// TestCLIBatchMode runs the generator over a tree of charts
+func TestCLIBatchMode(t *testing.T) {
+	binaryPath := buildBinary(t)
+	root := t.TempDir()
+
+	examples := []string{"monitoring", "postgres", "virtual-machine"}
+	for _, name := range examples {
+		dir := filepath.Join(root, "apps", name)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, "charts", "sub"), 0o755))
+		values, err := os.ReadFile(filepath.Join("examples", name+".yaml"))
+		require.NoError(t, err)
+		for _, d := range []string{dir, filepath.Join(dir, "charts", "sub")} {
+			require.NoError(t, os.WriteFile(filepath.Join(d, "Chart.yaml"), []byte("name: "+name+"\n"), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(d, "values.yaml"), values, 0o644))
+		}
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "apps", "postgres", "README.md"), []byte("# Postgres\n\n## Parameters\n"), 0o644))
+
+	output, err := exec.Command(binaryPath, "batch", "-j", "2", filepath.Join(root, "apps", "*")).CombinedOutput()
+	require.NoError(t, err, "batch failed: %s", string(output))
+	require.Contains(t, string(output), "3 chart(s): 3 ok, 0 stale, 0 failed")
+
+	for _, name := range examples {
+		single := filepath.Join(t.TempDir(), "values.schema.json")
+		out, err := exec.Command(binaryPath, "-v", filepath.Join("examples", name+".yaml"), "-s", single).CombinedOutput()
+		require.NoError(t, err, string(out))
+		want, err := os.ReadFile(single)
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(root, "apps", name, "values.schema.json"))
+		require.NoError(t, err)
+		require.Equal(t, string(want), string(got), "batch and single runs should match for %s", name)
+
+		_, err = os.Stat(filepath.Join(root, "apps", name, "charts", "sub", "values.schema.json"))
+		require.True(t, os.IsNotExist(err), "subcharts must not be generated")
+	}
+	readmeData, err := os.ReadFile(filepath.Join(root, "apps", "postgres", "README.md"))
+	require.NoError(t, err)
+	require.Contains(t, string(readmeData), "### Common parameters")
+
+	// A broken chart fails without stopping the others
+	bad := filepath.Join(root, "extra", "bad")
+	require.NoError(t, os.MkdirAll(bad, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(bad, "Chart.yaml"), []byte("name: bad\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(bad, "values.yaml"), []byte("## @param {int} a - A\na: x\n"), 0o644))
+
+	output, err = exec.Command(binaryPath, "batch", "--check", root).CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "==> FAIL "+bad)
+	require.Contains(t, string(output), "4 chart(s): 3 ok, 0 stale, 1 failed")
+
+	// So does a chart whose outputs cannot be written
+	unwritable := filepath.Join(root, "extra", "unwritable")
+	require.NoError(t, os.MkdirAll(filepath.Join(unwritable, "values.schema.json"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(unwritable, "Chart.yaml"), []byte("name: unwritable\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(unwritable, "values.yaml"), []byte("## @param {int} a - A\na: 1\n"), 0o644))
+
+	output, err = exec.Command(binaryPath, "batch", filepath.Join(root, "extra")).CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "==> FAIL "+unwritable)
+	require.Contains(t, string(output), "write JSON schema: ")
+	require.Contains(t, string(output), "2 chart(s): 0 ok, 0 stale, 2 failed")
+}
+
+func TestCLIConfigFile(t *testing.T) {
+	binaryPath := buildBinary(t)
+	root := t.TempDir()
+	chart := filepath.Join(root, "packages", "apps", "demo")
+	require.NoError(t, os.MkdirAll(chart, 0o755))
+
+	config := `module: defaultpkg
+outputs:
+  schema: values.schema.json
+  go: types.go
+types:
+  Port: int32
+charts:
+  - match: packages/apps/*
+    module: demo
+`
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".cozyvalues-gen.yaml"), []byte(config), 0o644))
+	values := "## @param {Port} port - Port\nport: 80\n"
+	require.NoError(t, os.WriteFile(filepath.Join(chart, "values.yaml"), []byte(values), 0o644))
+
+	// Outputs, package name and type aliases come from the file
+	output, err := exec.Command(binaryPath, "-v", filepath.Join(chart, "values.yaml")).CombinedOutput()
+	require.NoError(t, err, "generation failed: %s", string(output))
+	code, err := os.ReadFile(filepath.Join(chart, "types.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(code), "package demo")
+	require.Contains(t, string(code), "int32")
+	_, err = os.Stat(filepath.Join(chart, "values.schema.json"))
+	require.NoError(t, err)
+
+	// Flags override the file
+	goOut := filepath.Join(t.TempDir(), "out.go")
+	output, err = exec.Command(binaryPath, "-v", filepath.Join(chart, "values.yaml"), "-g", goOut, "-m", "flagpkg").CombinedOutput()
+	require.NoError(t, err, "generation failed: %s", string(output))
+	code, err = os.ReadFile(goOut)
+	require.NoError(t, err)
+	require.Contains(t, string(code), "package flagpkg")
+
+	// Batch mode picks the file up per chart
+	require.NoError(t, os.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("name: demo\n"), 0o644))
+	output, err = exec.Command(binaryPath, "batch", "--check", root).CombinedOutput()
+	require.NoError(t, err, "batch failed: %s", string(output))
+	require.Contains(t, string(output), "1 chart(s): 1 ok, 0 stale, 0 failed")
+}
+
+func TestCLIDumpModel(t *testing.T) {
+	binaryPath := buildBinary(t)
+
+	output, err := exec.Command(binaryPath, "-v", filepath.Join("examples", "postgres.yaml"), "--dump-model", "json").Output()
+	require.NoError(t, err)
+	var model cozyvalues.Model
+	require.NoError(t, json.Unmarshal(output, &model))
+	require.Equal(t, "external", model.Params[0].Name)
+	require.Equal(t, "Common parameters", model.Params[0].Section)
+	require.NotEmpty(t, model.Types)
+
+	output, err = exec.Command(binaryPath, "-v", filepath.Join("examples", "postgres.yaml"), "--dump-model", "xml").CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), `unsupported format "xml"`)
+}
+
+func TestCLILintOptionalByDefault(t *testing.T) {
+	binaryPath := buildBinary(t)
+	values := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(values, []byte("## @param {string} host - Host\n## @param {int} replicas - Replicas\nreplicas: 1\n"), 0o644))
+
+	output, err := exec.Command(binaryPath, "lint", values).CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "host: required, but not set in the values file")
+
+	// The flag relaxes lint like the generator
+	output, err = exec.Command(binaryPath, "lint", "--optional-by-default", values).CombinedOutput()
+	require.NoError(t, err, "lint failed: %s", string(output))
+	output, err = exec.Command(binaryPath, "--optional-by-default", "-v", values, "-s", filepath.Join(t.TempDir(), "values.schema.json")).CombinedOutput()
+	require.NoError(t, err, "generation failed: %s", string(output))
+}
+
+func TestCLIValueErrors(t *testing.T) {
+	binaryPath := buildBinary(t)
+	values := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(values, []byte("## @param {int} n - N\nn: x\n"), 0o644))
+
+	// Value errors carry their position, not the --check prefix
+	output, err := exec.Command(binaryPath, "-v", values, "-s", filepath.Join(t.TempDir(), "values.schema.json")).CombinedOutput()
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(string(output), values+":2:4: n: expected"), string(output))
+}
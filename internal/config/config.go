@@ -0,0 +1,215 @@
+// Package config loads .cozyvalues-gen.yaml project files.
+//
+// The file is discovered by walking up from the directory of a values file.
+// Top-level settings are repo-wide defaults; entries under charts override
+// them for every chart directory matching a glob, later entries winning:
+//
+//	module: values
+//	groupName: apps.cozystack.io
+//	outputs:
+//	  schema: values.schema.json
+//	  readme: README.md
+//	types:
+//	  Port: int
+//	optionalByDefault: true
+//	lint:
+//	  rules:
+//	    missing-description: off
+//	charts:
+//	  - match: packages/extra/*
+//	    groupName: extra.cozystack.io
+//	    outputs:
+//	      readme: "" # disabled
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cozystack/cozyvalues-gen/internal/lint"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the project configuration file.
+const FileName = ".cozyvalues-gen.yaml"
+
+// Settings are the generator settings of one chart. Nil fields are unset;
+// an empty output path disables that output.
+type Settings struct {
+	Module      *string           `yaml:"module"`
+	GroupName   *string           `yaml:"groupName"`
+	VersionName *string           `yaml:"versionName"`
+	Outputs     Outputs           `yaml:"outputs"`
+	AllowTags   []string          `yaml:"allowTags"`
+	Types       map[string]string `yaml:"types"` // alias name → type expression
+	// OptionalByDefault makes params and fields without @required optional.
+	OptionalByDefault *bool `yaml:"optionalByDefault"`
+	Lint              Lint  `yaml:"lint"`
+}
+
+// Outputs are paths relative to the chart directory.
+type Outputs struct {
+	Go     *string `yaml:"go"`
+	CRD    *string `yaml:"crd"`
+	Schema *string `yaml:"schema"`
+	Readme *string `yaml:"readme"`
+}
+
+// Lint configures the lint subcommand.
+type Lint struct {
+	Rules lint.Config `yaml:"rules"`
+}
+
+// Override applies Settings to the charts matching a glob, relative to the
+// directory of the configuration file.
+type Override struct {
+	Match    string `yaml:"match"`
+	Settings `yaml:",inline"`
+}
+
+// File is a parsed configuration file.
+type File struct {
+	Path     string `yaml:"-"`
+	Settings `yaml:",inline"`
+	Charts   []Override `yaml:"charts"`
+}
+
+// Load reads and validates the configuration file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{Path: path}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, s := range append([]Settings{f.Settings}, overrides(f.Charts)...) {
+		if err := s.Lint.Rules.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	for _, o := range f.Charts {
+		if _, err := filepath.Match(o.Match, ""); err != nil || o.Match == "" {
+			return nil, fmt.Errorf("%s: invalid chart match %q", path, o.Match)
+		}
+	}
+	return f, nil
+}
+
+func overrides(charts []Override) []Settings {
+	out := make([]Settings, len(charts))
+	for i, o := range charts {
+		out[i] = o.Settings
+	}
+	return out
+}
+
+// Find returns the nearest configuration file in dir or one of its parents,
+// or "" when there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		p := filepath.Join(dir, FileName)
+		if st, err := os.Stat(p); err == nil && !st.IsDir() {
+			return p, nil
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Discover finds and loads the configuration file that applies to dir. It
+// returns nil without error when there is none.
+func Discover(dir string) (*File, error) {
+	p, err := Find(dir)
+	if err != nil || p == "" {
+		return nil, err
+	}
+	return Load(p)
+}
+
+// For returns the settings of the chart in dir: the repo-wide defaults with
+// every matching override applied in order. A nil File yields empty settings.
+func (f *File) For(dir string) Settings {
+	if f == nil {
+		return Settings{}
+	}
+	s := f.Settings.clone()
+	rel := chartPath(filepath.Dir(f.Path), dir)
+	for _, o := range f.Charts {
+		if ok, _ := filepath.Match(o.Match, rel); ok {
+			s.merge(o.Settings)
+		}
+	}
+	return s
+}
+
+// chartPath returns dir relative to base in slash form, or dir itself when
+// it is outside base.
+func chartPath(base, dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (s Settings) clone() Settings {
+	c := s
+	c.AllowTags = append([]string(nil), s.AllowTags...)
+	c.Types = map[string]string{}
+	for k, v := range s.Types {
+		c.Types[k] = v
+	}
+	c.Lint.Rules = lint.Config{}
+	for k, v := range s.Lint.Rules {
+		c.Lint.Rules[k] = v
+	}
+	return c
+}
+
+// merge applies the fields set in o on top of s.
+func (s *Settings) merge(o Settings) {
+	set := func(dst **string, src *string) {
+		if src != nil {
+			*dst = src
+		}
+	}
+	set(&s.Module, o.Module)
+	set(&s.GroupName, o.GroupName)
+	set(&s.VersionName, o.VersionName)
+	set(&s.Outputs.Go, o.Outputs.Go)
+	set(&s.Outputs.CRD, o.Outputs.CRD)
+	set(&s.Outputs.Schema, o.Outputs.Schema)
+	set(&s.Outputs.Readme, o.Outputs.Readme)
+	if o.OptionalByDefault != nil {
+		s.OptionalByDefault = o.OptionalByDefault
+	}
+	s.AllowTags = append(s.AllowTags, o.AllowTags...)
+	for k, v := range o.Types {
+		s.Types[k] = v
+	}
+	for k, v := range o.Lint.Rules {
+		s.Lint.Rules[k] = v
+	}
+}
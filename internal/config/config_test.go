@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cozystack/cozyvalues-gen/internal/lint"
+	"github.com/stretchr/testify/require"
+)
+
+const sample = `module: values
+groupName: apps.cozystack.io
+outputs:
+  schema: values.schema.json
+  readme: README.md
+allowTags: [schema]
+types:
+  Port: int32
+lint:
+  rules:
+    missing-description: off
+charts:
+  - match: packages/extra/*
+    groupName: extra.cozystack.io
+    outputs:
+      readme: ""
+  - match: packages/extra/bucket
+    module: bucket
+    allowTags: [ignore]
+    types:
+      Size: quantity
+`
+
+func writeConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	p := filepath.Join(dir, FileName)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	return p
+}
+
+func TestDiscoverWalksUp(t *testing.T) {
+	root := t.TempDir()
+	p := writeConfig(t, root, sample)
+	chart := filepath.Join(root, "packages", "apps", "redis")
+	require.NoError(t, os.MkdirAll(chart, 0o755))
+
+	got, err := Find(chart)
+	require.NoError(t, err)
+	require.Equal(t, p, got)
+
+	f, err := Discover(chart)
+	require.NoError(t, err)
+	require.Equal(t, "values", *f.For(chart).Module)
+
+	f, err = Discover(t.TempDir())
+	require.NoError(t, err)
+	require.Nil(t, f)
+	require.Equal(t, Settings{}, f.For("."))
+}
+
+func TestForAppliesOverridesInOrder(t *testing.T) {
+	root := t.TempDir()
+	f, err := Load(writeConfig(t, root, sample))
+	require.NoError(t, err)
+
+	apps := f.For(filepath.Join(root, "packages", "apps", "redis"))
+	require.Equal(t, "apps.cozystack.io", *apps.GroupName)
+	require.Equal(t, "README.md", *apps.Outputs.Readme)
+	require.Nil(t, apps.VersionName)
+	require.Equal(t, []string{"schema"}, apps.AllowTags)
+
+	bucket := f.For(filepath.Join(root, "packages", "extra", "bucket"))
+	require.Equal(t, "bucket", *bucket.Module)
+	require.Equal(t, "extra.cozystack.io", *bucket.GroupName)
+	require.Equal(t, "", *bucket.Outputs.Readme, "an empty path disables the output")
+	require.Equal(t, "values.schema.json", *bucket.Outputs.Schema)
+	require.Equal(t, []string{"schema", "ignore"}, bucket.AllowTags)
+	require.Equal(t, map[string]string{"Port": "int32", "Size": "quantity"}, bucket.Types)
+	require.Equal(t, lint.Off, bucket.Lint.Rules["missing-description"])
+
+	// Overrides must not leak into the defaults.
+	require.Equal(t, map[string]string{"Port": "int32"}, f.For(root).Types)
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown key", "modul: values\n", "field modul not found"},
+		{"unknown rule", "lint:\n  rules:\n    no-such-rule: error\n", "no-such-rule"},
+		{"bad severity", "lint:\n  rules:\n    missing-param: loud\n", "loud"},
+		{"bad match", "charts:\n  - match: '[a'\n", `invalid chart match "[a"`},
+		{"empty match", "charts:\n  - module: x\n", `invalid chart match ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, t.TempDir(), tt.content))
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestLoadEmpty(t *testing.T) {
+	f, err := Load(writeConfig(t, t.TempDir(), ""))
+	require.NoError(t, err)
+	require.Empty(t, f.Charts)
+}
+
+func TestOptionalByDefault(t *testing.T) {
+	root := t.TempDir()
+	f, err := Load(writeConfig(t, root, "optionalByDefault: true\ncharts:\n  - match: legacy/*\n    optionalByDefault: false\n"))
+	require.NoError(t, err)
+
+	require.True(t, *f.For(filepath.Join(root, "apps", "redis")).OptionalByDefault)
+	require.False(t, *f.For(filepath.Join(root, "legacy", "redis")).OptionalByDefault)
+	require.Nil(t, (*File)(nil).For(root).OptionalByDefault)
+}
@@ -0,0 +1,88 @@
+// Package diag provides source positions and caret-style diagnostics for
+// annotated values files.
+package diag
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a location in a values file. Line and Col are 1-based; Col counts bytes.
+type Pos struct {
+	File string
+	Line int
+	Col  int
+	Text string // the full source line, used to render the caret
+}
+
+// At returns the position of column col (1-based) on line (1-based) of lines.
+func At(file string, lines []string, line, col int) Pos {
+	p := Pos{File: file, Line: line, Col: col}
+	if line > 0 && line <= len(lines) {
+		p.Text = strings.TrimRight(lines[line-1], "\r")
+	}
+	return p
+}
+
+// IsValid reports whether the position refers to a source line.
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return p.File
+	}
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// Find moves the position to the first occurrence of s at or after the
+// current column. The position is returned unchanged when s is not found.
+func (p Pos) Find(s string) Pos {
+	start := p.Col - 1
+	if s == "" || start < 0 || start > len(p.Text) {
+		return p
+	}
+	if i := strings.Index(p.Text[start:], s); i >= 0 {
+		p.Col += i
+	}
+	return p
+}
+
+// Error is a diagnostic tied to a source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+// Errorf returns an *Error at pos.
+func Errorf(pos Pos, format string, args ...interface{}) error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Error renders "file:line:col: msg" followed by the source line and a caret.
+func (e *Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", e.Pos, e.Msg)
+	if e.Pos.Text != "" {
+		b.WriteString("\n    " + e.Pos.Text + "\n    " + caretIndent(e.Pos.Text, e.Pos.Col) + "^")
+	}
+	return b.String()
+}
+
+// caretIndent keeps tabs from the source line so the caret lines up.
+func caretIndent(text string, col int) string {
+	var b strings.Builder
+	for i := 0; i < col-1 && i < len(text); i++ {
+		if text[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
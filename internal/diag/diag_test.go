@@ -0,0 +1,32 @@
+package diag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorRendersCaret(t *testing.T) {
+	lines := []string{"foo: 1", "## @param {Bar} bar - Bar"}
+	pos := At("values.yaml", lines, 2, 4).Find("Bar")
+	require.Equal(t, "values.yaml:2:12", pos.String())
+
+	err := Errorf(pos, "undefined type %q", "Bar")
+	require.Equal(t, "values.yaml:2:12: undefined type \"Bar\"\n"+
+		"    ## @param {Bar} bar - Bar\n"+
+		"               ^", err.Error())
+}
+
+func TestErrorWithoutPosition(t *testing.T) {
+	require.Equal(t, "boom", Errorf(Pos{}, "boom").Error())
+}
+
+func TestCaretKeepsTabs(t *testing.T) {
+	err := Errorf(At("v.yaml", []string{"\tkey: x"}, 1, 2), "bad key")
+	require.Equal(t, "v.yaml:1:2: bad key\n    \tkey: x\n    \t^", err.Error())
+}
+
+func TestFindMissingKeepsPosition(t *testing.T) {
+	pos := At("v.yaml", []string{"abc"}, 1, 2)
+	require.Equal(t, pos, pos.Find("zzz"))
+}
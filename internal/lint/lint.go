@@ -0,0 +1,312 @@
+// Package lint runs named house-style rules over an annotated values.yaml.
+package lint
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity controls whether a rule runs and how its findings are reported.
+type Severity int
+
+const (
+	Off Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	default:
+		return "off"
+	}
+}
+
+// ParseSeverity accepts "off", "warning" (or "warn") and "error".
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "off", "none", "disabled":
+		return Off, nil
+	case "warning", "warn":
+		return Warning, nil
+	case "error":
+		return Error, nil
+	}
+	return Off, fmt.Errorf("unknown severity %q (want off, warning or error)", s)
+}
+
+// UnmarshalYAML lets severities be written as plain strings in config files.
+func (s *Severity) UnmarshalYAML(n *yaml.Node) error {
+	v, err := ParseSeverity(n.Value)
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// Input is everything a rule can inspect.
+type Input struct {
+	File   string
+	Rows   []openapi.Raw
+	Values *yaml.Node // document root of the values file
+	Lines  []string
+}
+
+// Finding is a problem reported by a rule.
+type Finding struct {
+	Pos diag.Pos
+	Msg string
+}
+
+// Rule is a named check with a default severity.
+type Rule struct {
+	Name     string
+	Doc      string
+	Severity Severity
+	Check    func(in *Input) []Finding
+}
+
+// Diagnostic is a finding together with the rule and effective severity.
+type Diagnostic struct {
+	Rule     string
+	Severity Severity
+	Finding
+}
+
+func (d Diagnostic) String() string {
+	return diag.Errorf(d.Pos, "%s: %s (%s)", d.Severity, d.Msg, d.Rule).Error()
+}
+
+// Config overrides rule severities by name; rules not listed keep their default.
+type Config map[string]Severity
+
+// Rules lists every available rule in reporting order.
+var Rules = []Rule{
+	{Name: "missing-param", Doc: "top-level values keys without a @param annotation", Severity: Error, Check: checkMissingParam},
+	{Name: "unused-typedef", Doc: "@typedef and @enum types that no @param or @field references", Severity: Warning, Check: checkUnusedTypedef},
+	{Name: "orphan-field", Doc: "@field annotations that appear before any @typedef", Severity: Error, Check: checkOrphanField},
+	{Name: "duplicate-definition", Doc: "params, fields or types declared more than once", Severity: Error, Check: checkDuplicates},
+	{Name: "missing-description", Doc: "annotations without a description", Severity: Warning, Check: checkMissingDescription},
+	{Name: "invalid-value", Doc: "values and inline defaults that violate their declared type or constraints", Severity: Error, Check: checkValues},
+	{Name: "non-camel-case", Doc: "param and field names that are not lowerCamelCase", Severity: Warning, Check: checkCamelCase},
+}
+
+// Validate reports rule names in cfg that do not exist.
+func (cfg Config) Validate() error {
+	for name := range cfg {
+		if lookup(name) == nil {
+			return fmt.Errorf("unknown lint rule %q", name)
+		}
+	}
+	return nil
+}
+
+func lookup(name string) *Rule {
+	for i := range Rules {
+		if Rules[i].Name == name {
+			return &Rules[i]
+		}
+	}
+	return nil
+}
+
+// Load parses the values file at path into an Input.
+func Load(path string, opts openapi.ParseOptions) (*Input, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := openapi.ParseWithOptions(path, opts)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Input{File: path, Rows: rows, Values: &doc, Lines: strings.Split(string(data), "\n")}, nil
+}
+
+// Run applies every enabled rule to in, ordered by position.
+func Run(in *Input, cfg Config) []Diagnostic {
+	var out []Diagnostic
+	for _, r := range Rules {
+		sev := r.Severity
+		if s, ok := cfg[r.Name]; ok {
+			sev = s
+		}
+		if sev == Off {
+			continue
+		}
+		for _, f := range r.Check(in) {
+			out = append(out, Diagnostic{Rule: r.Name, Severity: sev, Finding: f})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Pos.Line != out[j].Pos.Line {
+			return out[i].Pos.Line < out[j].Pos.Line
+		}
+		return out[i].Pos.Col < out[j].Pos.Col
+	})
+	return out
+}
+
+/* -------------------------------------------------------------------------- */
+/*  Rules                                                                      */
+/* -------------------------------------------------------------------------- */
+
+func describe(r openapi.Raw) string {
+	switch {
+	case r.IsParam():
+		return fmt.Sprintf("parameter %q", strings.Join(r.Path, "."))
+	case r.IsUnion():
+		return fmt.Sprintf("union %q", r.Path[0])
+	case r.IsTypedef():
+		return fmt.Sprintf("typedef %q", r.Path[0])
+	case r.IsEnum():
+		return fmt.Sprintf("enum %q", r.Path[0])
+	default:
+		return fmt.Sprintf("field %q", strings.Join(r.Path, "."))
+	}
+}
+
+// name returns the annotated key of a param or field.
+func name(r openapi.Raw) string { return r.Path[len(r.Path)-1] }
+
+func checkMissingParam(in *Input) []Finding {
+	params := map[string]bool{}
+	for _, r := range in.Rows {
+		if r.IsParam() {
+			params[strings.TrimSuffix(r.Path[0], "[]")] = true
+		}
+	}
+	if len(in.Values.Content) == 0 || in.Values.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+	var out []Finding
+	top := in.Values.Content[0]
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		k := top.Content[i]
+		if !params[k.Value] {
+			out = append(out, Finding{
+				Pos: diag.At(in.File, in.Lines, k.Line, k.Column),
+				Msg: fmt.Sprintf("key %q has no @param annotation", k.Value),
+			})
+		}
+	}
+	return out
+}
+
+func checkUnusedTypedef(in *Input) []Finding {
+	used := map[string]bool{}
+	for _, r := range in.Rows {
+		if r.IsParam() || r.IsField() || r.IsAlias() {
+			used[openapi.BaseType(r.TypeExpr)] = true
+		}
+		for _, v := range r.Variants {
+			used[v.Type] = true
+		}
+		for _, e := range r.Embeds {
+			used[e.Type] = true
+		}
+	}
+	var out []Finding
+	for _, r := range in.Rows {
+		if (r.IsTypedef() || r.IsEnum()) && !used[r.Path[0]] {
+			at := r.Pos.Find("}").Find(r.Path[0])
+			if r.IsUnion() {
+				at = r.Pos.Find("{").Find(r.Path[0]) // @union {Name}
+			}
+			out = append(out, Finding{Pos: at, Msg: describe(r) + " is never referenced"})
+		}
+	}
+	return out
+}
+
+func checkOrphanField(in *Input) []Finding {
+	var out []Finding
+	for _, r := range in.Rows {
+		if r.IsField() && len(r.Path) < 2 {
+			out = append(out, Finding{Pos: r.Pos, Msg: describe(r) + " appears before any @typedef and is ignored"})
+		}
+	}
+	return out
+}
+
+func checkDuplicates(in *Input) []Finding {
+	seen := map[string]diag.Pos{}
+	var out []Finding
+	for _, r := range in.Rows {
+		var key string
+		switch {
+		case r.IsParam():
+			key = "param\x00" + strings.Join(r.Path, ".")
+		case r.IsField() && len(r.Path) >= 2:
+			key = "field\x00" + strings.Join(r.Path, ".")
+		case r.IsTypedef(), r.IsEnum():
+			key = "type\x00" + r.Path[0]
+		default:
+			continue
+		}
+		if prev, dup := seen[key]; dup {
+			out = append(out, Finding{
+				Pos: r.Pos.Find("}").Find(name(r)),
+				Msg: fmt.Sprintf("%s is already defined at %s", describe(r), prev),
+			})
+			continue
+		}
+		seen[key] = r.Pos
+	}
+	return out
+}
+
+func checkMissingDescription(in *Input) []Finding {
+	var out []Finding
+	for _, r := range in.Rows {
+		if strings.TrimSpace(r.Description) == "" {
+			out = append(out, Finding{Pos: r.Pos, Msg: describe(r) + " has no description"})
+		}
+	}
+	return out
+}
+
+func checkValues(in *Input) []Finding {
+	var out []Finding
+	for _, e := range openapi.Check(openapi.Build(in.Rows), in.File, []byte(strings.Join(in.Lines, "\n"))) {
+		out = append(out, Finding{Pos: e.Pos, Msg: e.Msg})
+	}
+	return out
+}
+
+var (
+	reCamel = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+	reWord  = regexp.MustCompile(`^\w+$`)
+)
+
+func checkCamelCase(in *Input) []Finding {
+	var out []Finding
+	for _, r := range in.Rows {
+		if !r.IsParam() && !r.IsField() {
+			continue
+		}
+		// Quoted keys such as "cert-manager" mirror an external format on
+		// purpose and are left alone.
+		n := strings.TrimSuffix(name(r), "[]")
+		if reWord.MatchString(n) && !reCamel.MatchString(n) {
+			out = append(out, Finding{Pos: r.Pos.Find("}").Find(n), Msg: describe(r) + " is not lowerCamelCase"})
+		}
+	}
+	return out
+}
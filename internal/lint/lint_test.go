@@ -0,0 +1,202 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func run(t *testing.T, content string, cfg Config) []Diagnostic {
+	t.Helper()
+	in, err := Load(writeTempFile(t, content), openapi.ParseOptions{})
+	require.NoError(t, err)
+	return Run(in, cfg)
+}
+
+// rules returns "rule@line" for each diagnostic.
+func rules(ds []Diagnostic) []string {
+	var out []string
+	for _, d := range ds {
+		out = append(out, d.Rule+"@"+d.Pos.String()[len(d.Pos.File)+1:])
+	}
+	return out
+}
+
+func TestCleanFileHasNoDiagnostics(t *testing.T) {
+	const yaml = `
+## @enum {string} Size - Size preset
+## @value small
+
+## @typedef {struct} Db - Database
+## @field {string} host - Host
+## @field {Size} size - Size
+
+## @param {Db} db - Database
+db:
+  host: x
+  size: small
+`
+	require.Empty(t, run(t, yaml, nil))
+}
+
+func TestRules(t *testing.T) {
+	const yaml = `## @field {string} stray - Before any typedef
+## @typedef {struct} Unused - Nobody uses me
+## @field {string} a - A
+## @field {string} a - A again
+## @param {string} name - Name
+## @param {string} name - Name again
+## @param {int} Bad_key
+name: x
+undocumented: 1
+Bad_key: 1
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{
+		"orphan-field@1:4",
+		"unused-typedef@2:22",
+		"duplicate-definition@4:20",
+		"duplicate-definition@6:20",
+		"missing-description@7:4",
+		"non-camel-case@7:17",
+		"missing-param@9:1",
+	}, rules(ds))
+	require.Equal(t, Error, ds[0].Severity)
+	require.Equal(t, Warning, ds[4].Severity)
+	require.Contains(t, ds[3].String(), "already defined at")
+	require.Contains(t, ds[3].String(), ":5:4")
+}
+
+func TestConfigOverridesSeverity(t *testing.T) {
+	const yaml = `## @param {string} name
+## @typedef {struct} Unused - Nobody uses me
+name: x
+extra: 1
+`
+	ds := run(t, yaml, Config{"missing-param": Off, "missing-description": Error})
+	require.Equal(t, []string{"missing-description@1:4", "unused-typedef@2:22"}, rules(ds))
+	require.Equal(t, Error, ds[0].Severity)
+	require.Equal(t, Warning, ds[1].Severity)
+
+	require.Error(t, Config{"no-such-rule": Off}.Validate())
+}
+
+func TestParseSeverity(t *testing.T) {
+	for in, want := range map[string]Severity{"off": Off, "warn": Warning, "Warning": Warning, "error": Error} {
+		got, err := ParseSeverity(in)
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	}
+	_, err := ParseSeverity("fatal")
+	require.Error(t, err)
+}
+
+func TestInvalidValueRule(t *testing.T) {
+	const yaml = `## @param {int} replicas - Replicas
+replicas: three
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"invalid-value@2:11"}, rules(ds))
+	require.Contains(t, ds[0].Msg, "expected an integer")
+}
+
+func TestDottedParams(t *testing.T) {
+	const yaml = `## @param {string} db.host - Host
+## @param {int} db.port - Port
+## @param {int} db.port - Port again
+## @param {string} jobs[].name - Job name
+db:
+  host: x
+  port: 1
+jobs: []
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"duplicate-definition@3:20"}, rules(ds))
+	require.Contains(t, ds[0].String(), `parameter "db.port" is already defined`)
+}
+
+func TestQuotedNamesSkipCamelCase(t *testing.T) {
+	const yaml = `## @param {bool} "cert-manager" - Cert manager
+## @param {bool} "cert_manager" - Snake case
+cert-manager: true
+cert_manager: true
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"non-camel-case@2:19"}, rules(ds))
+}
+
+func TestUnionVariantsAreUsed(t *testing.T) {
+	const yaml = `## @typedef {struct} S3 - S3 bucket
+## @field {string} bucket - Bucket
+
+## @union {Target} - Backup target
+## @variant s3 S3
+
+## @union {Unused} - Nobody uses me
+## @variant s3 S3
+
+## @param {Target} target - Target
+target:
+  type: s3
+  s3:
+    bucket: backups
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"unused-typedef@7:12"}, rules(ds))
+	require.Contains(t, ds[0].String(), `union "Unused" is never referenced`)
+}
+
+func TestEmbeddedTypedefsAreUsed(t *testing.T) {
+	const yaml = `## @typedef {struct} Base - Common settings
+## @field {bool} enabled - Enabled
+## @typedef {struct} Extra - Extra settings
+## @field {string} [note] - Note
+
+## @typedef {struct} Replica - Replica @extends Base
+## @embed {Extra}
+
+## @param {Replica} replica - Replica
+replica:
+  enabled: true
+`
+	require.Empty(t, rules(run(t, yaml, nil)))
+}
+
+func TestTypeAliasesAreUsed(t *testing.T) {
+	const yaml = `## @typedef {string} Hostname - DNS name
+## @typedef {[]Hostname} Hostnames - DNS names
+## @typedef {map[string]string} Labels - Nobody uses me
+
+## @param {Hostnames} hosts - Hosts
+hosts: []
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"unused-typedef@3:33"}, rules(ds))
+	require.Contains(t, ds[0].String(), `typedef "Labels" is never referenced`)
+}
+
+func TestDottedFields(t *testing.T) {
+	const yaml = `## @typedef {struct} Db - Db
+## @field {struct} backup - Backup
+## @field {string} backup.schedule - Schedule
+## @field {string} backup.schedule - Schedule again
+
+## @param {Db} db - Db
+db:
+  backup:
+    schedule: daily
+`
+	ds := run(t, yaml, nil)
+	require.Equal(t, []string{"duplicate-definition@4:27"}, rules(ds))
+	require.Contains(t, ds[0].String(), `field "Db.backup.schedule" is already defined`)
+}
@@ -0,0 +1,179 @@
+package openapi
+
+import (
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  @typedef aliases                                                           */
+/* -------------------------------------------------------------------------- */
+
+// IsAlias reports whether n is a @typedef of a non-struct type, such as
+// {[]string} or {string}. It becomes a named Go type that carries the
+// constraints of the typedef to every param and field of that type.
+func (n *Node) IsAlias() bool {
+	if n.Parent == nil || n.Parent.Parent != nil || n.IsParam || !n.Pos.IsValid() {
+		return false
+	}
+	te := strings.TrimSpace(n.TypeExpr)
+	return len(n.Enums) == 0 && len(n.Child) == 0 && te != "" && te != "struct"
+}
+
+// Underlying returns the type expression t with every alias of root replaced
+// by the type it names, including the item and value types of lists and
+// maps: with @typedef {[]string} Hosts, *Hosts becomes *[]string.
+func Underlying(root *Node, t string) string {
+	return underlying(root, t, map[string]bool{})
+}
+
+func underlying(root *Node, t string, seen map[string]bool) string {
+	t = strings.TrimSpace(t)
+	switch {
+	case strings.HasPrefix(t, "*"):
+		return "*" + underlying(root, t[1:], seen)
+	case strings.HasPrefix(t, "[]"):
+		return "[]" + underlying(root, t[2:], seen)
+	case strings.HasPrefix(t, "map[") && strings.Contains(t, "]"):
+		i := strings.Index(t, "]")
+		return t[:i+1] + underlying(root, t[i+1:], seen)
+	}
+	if root == nil || seen[t] {
+		return t // cycles are reported by the checker
+	}
+	if n := root.Child[t]; n != nil && n.IsAlias() {
+		seen[t] = true
+		defer delete(seen, t)
+		return underlying(root, n.TypeExpr, seen)
+	}
+	return t
+}
+
+// underlyingOf returns the type expression of n with its aliases resolved.
+func underlyingOf(n *Node) string {
+	root := n
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	return Underlying(root, n.TypeExpr)
+}
+
+// aliasOf returns the alias the type expression t names, possibly behind a
+// pointer, or nil.
+func aliasOf(root *Node, t string) *Node {
+	t = strings.TrimPrefix(strings.TrimSpace(t), "*")
+	if n := root.Child[t]; n != nil && n.IsAlias() {
+		return n
+	}
+	return nil
+}
+
+// Unaliased returns n with the type expression and constraints of the aliases
+// its type names, possibly behind a pointer, filled in: the constraints of n
+// win over those of the alias, as field markers do in the schema.
+func Unaliased(root, n *Node) *Node {
+	seen := map[*Node]bool{}
+	for a := aliasOf(root, n.TypeExpr); a != nil && !seen[a]; a = aliasOf(root, n.TypeExpr) {
+		seen[a] = true
+		ptr := strings.HasPrefix(strings.TrimSpace(n.TypeExpr), "*")
+		n = withAlias(a, n)
+		if ptr {
+			n.TypeExpr = "*" + n.TypeExpr
+		}
+	}
+	return n
+}
+
+// withAlias returns a copy of decl, of the alias type def, with the type
+// expression of def and the constraints of def that decl does not set.
+func withAlias(def, decl *Node) *Node {
+	n := *decl
+	n.TypeExpr = def.TypeExpr
+	if n.Minimum == nil {
+		n.Minimum, n.ExclusiveMinimum = def.Minimum, def.ExclusiveMinimum
+	}
+	if n.Maximum == nil {
+		n.Maximum, n.ExclusiveMaximum = def.Maximum, def.ExclusiveMaximum
+	}
+	if n.MinLength == nil {
+		n.MinLength = def.MinLength
+	}
+	if n.MaxLength == nil {
+		n.MaxLength = def.MaxLength
+	}
+	if n.Pattern == "" {
+		n.Pattern = def.Pattern
+	}
+	if n.MinItems == nil {
+		n.MinItems = def.MinItems
+	}
+	if n.MaxItems == nil {
+		n.MaxItems = def.MaxItems
+	}
+	if n.ListType == "" {
+		n.ListType, n.ListMapKeys = def.ListType, def.ListMapKeys
+	}
+	if n.MinProperties == nil {
+		n.MinProperties = def.MinProperties
+	}
+	if n.MaxProperties == nil {
+		n.MaxProperties = def.MaxProperties
+	}
+	if n.KeyPattern == "" {
+		n.KeyPattern = def.KeyPattern
+	}
+	return &n
+}
+
+// aliasErrors reports aliases that name themselves, directly or through
+// other aliases, such as @typedef {[]A} B and @typedef {B} A: they have no
+// schema.
+func aliasErrors(root *Node) []*diag.Error {
+	var errs []*diag.Error
+	for _, k := range sortedKeys(root.Child) {
+		n := root.Child[k]
+		if !n.IsAlias() {
+			continue
+		}
+		path := []string{n.Name}
+		for t := aliasOf(root, BaseType(n.TypeExpr)); t != nil; t = aliasOf(root, BaseType(t.TypeExpr)) {
+			path = append(path, t.Name)
+			if t == n {
+				errs = append(errs, diag.Errorf(n.Pos.Find("}").Find(n.Name), "%s: @typedef cycle %s", n.Name, strings.Join(path, " → ")).(*diag.Error))
+				break
+			}
+			if contains(path[:len(path)-1], t.Name) {
+				break // a cycle that n only leads to
+			}
+		}
+	}
+	return errs
+}
+
+// aliasMarkers returns the markers of the Go type generated for the alias n:
+// those of a field of its type, less the ones controller-gen only reads on
+// fields.
+func (g *gen) aliasMarkers(n *Node) []string {
+	var out []string
+	for _, m := range g.fieldMarkers(n, g.goType(n))[1:] {
+		if !strings.HasPrefix(m, "+kubebuilder:example=") {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// writeAlias writes the Go type of the alias n. Package-qualified types,
+// such as resource.Quantity, get a Go alias: a defined type would drop
+// their JSON methods.
+func (g *gen) writeAlias(n *Node) {
+	for _, m := range g.aliasMarkers(n) {
+		g.buf.WriteString("// " + m + "\n")
+	}
+	typ, sep := g.goType(n), " "
+	if isExternalType(typ) {
+		sep = " = "
+	}
+	g.buf.WriteString("type " + g.typeName(n.Name) + sep + typ + "\n\n")
+}
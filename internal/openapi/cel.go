@@ -0,0 +1,255 @@
+package openapi
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"gopkg.in/yaml.v3"
+	apiextinternal "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/cel/model"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  @validate rules                                                            */
+/* -------------------------------------------------------------------------- */
+
+// rules compiles the @validate, @requiredIf and @union rules of the tree and
+// evaluates them against the values document top, the way the API server
+// does for the CRD, so a broken rule or a default that fails it is caught at
+// generation time. top may be nil when the values file has no mapping.
+func (c *checker) rules(top *yaml.Node) {
+	at := map[string]diag.Pos{}      // rule → its first @validate
+	requiredIf := map[string]*Node{} // message → its first @requiredIf param or field
+	conditional := false             // @requiredIf or @union rules are generated
+	var collect func(n *Node)
+	collect = func(n *Node) {
+		for _, k := range sortedKeys(n.Child) {
+			ch := n.Child[k]
+			for _, v := range ch.Validations {
+				if _, ok := at[v.Rule]; !ok {
+					at[v.Rule] = v.Pos
+				}
+			}
+			if ch.RequiredIf != nil {
+				if _, ok := requiredIf[requiredIfMessage(ch)]; !ok {
+					requiredIf[requiredIfMessage(ch)] = ch
+				}
+			}
+			conditional = conditional || ch.RequiredIf != nil || len(ch.Variants) > 0
+			collect(ch)
+		}
+	}
+	collect(c.root)
+	if len(at) == 0 && !conditional {
+		return
+	}
+
+	// Schema errors are reported when the schema is generated
+	spec, err := BuildSchema(c.root)
+	if err != nil {
+		return
+	}
+	s, err := structural(spec)
+	if err != nil {
+		return
+	}
+
+	compiled := true
+	reported := map[string]bool{}
+	env := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), true)
+	walkStructural(s, func(s *structuralschema.Structural) {
+		if s.Type == "" && !s.XIntOrString && len(s.XValidations) > 0 {
+			compiled = false // rules on scalar unions, reported by constraints
+			return
+		}
+		results, err := cel.Compile(s, model.SchemaDeclType(s, false), celconfig.PerCallLimit, env, cel.NewExpressionsEnvLoader())
+		for i, r := range s.XValidations {
+			msg := ""
+			switch {
+			case err != nil:
+				msg = err.Error()
+			case results[i].Error != nil:
+				msg = results[i].Error.Detail
+			default:
+				continue
+			}
+			compiled = false
+			if !reported[r.Rule] {
+				reported[r.Rule] = true
+				c.errorf(at[r.Rule], "invalid @validate rule %q: %s", r.Rule, msg)
+			}
+		}
+	})
+	if !compiled || top == nil {
+		return
+	}
+
+	raw, err := yaml.Marshal(top)
+	if err != nil {
+		return
+	}
+	js, err := sigyaml.YAMLToJSON(raw)
+	if err != nil {
+		return
+	}
+	var obj interface{}
+	if err := utiljson.Unmarshal(js, &obj); err != nil {
+		return
+	}
+	errs, _ := cel.NewValidator(s, false, celconfig.PerCallLimit).
+		Validate(context.Background(), nil, s, obj, nil, celconfig.RuntimeCELCostBudget)
+	for _, e := range errs {
+		obj, format := top, "%[2]s"
+		if e.Field != "<nil>" { // not a rule of the values root
+			obj, format = yamlAt(top, e.Field), "%[1]s: %[2]s"
+		}
+		pos := c.yamlPos(obj)
+		if n, ok := requiredIf[e.Detail]; ok {
+			// At the key of the param or field, or at its annotation
+			pos = n.Pos.Find(n.Name)
+			if k := keyNode(obj, n.Name); k != nil {
+				pos = c.yamlPos(k)
+			}
+		}
+		c.errorf(pos, format, e.Field, e.Detail)
+	}
+}
+
+// keyNode returns the key named name of the mapping m, or nil.
+func keyNode(m *yaml.Node, name string) *yaml.Node {
+	m = resolveAlias(m)
+	if m.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == name {
+			return m.Content[i]
+		}
+	}
+	return nil
+}
+
+// immutables reports @immutable params and fields inside a list. The API
+// server cannot match list items to their old values, except by the keys of
+// a @listType map, so it rejects a CRD with a transition rule below others.
+func (c *checker) immutables() {
+	reported := map[*Node]bool{}
+	seen := map[string]bool{} // typedefs being walked, against recursive types
+	var visit func(n *Node, list string)
+	visit = func(n *Node, list string) {
+		if n.Immutable && list != "" && !reported[n] {
+			reported[n] = true
+			c.errorf(n.Pos.Find(n.Name), "%s: @immutable is not allowed inside the list %s, whose items have no old value to compare with", n.Name, list)
+		}
+		typ := strings.TrimPrefix(Underlying(c.root, n.TypeExpr), "*")
+		for keyed := n.ListType == "map"; ; keyed = false {
+			if strings.HasPrefix(typ, "[]") {
+				if list == "" && !keyed {
+					list = n.Name
+				}
+				typ = strings.TrimPrefix(strings.TrimSpace(typ[2:]), "*")
+			} else if strings.HasPrefix(typ, "map[") && strings.Contains(typ, "]") {
+				typ = strings.TrimPrefix(strings.TrimSpace(typ[strings.Index(typ, "]")+1:]), "*")
+			} else {
+				break
+			}
+		}
+		if def, ok := c.root.Child[typ]; ok && def != n && !def.IsParam && !seen[typ] {
+			seen[typ] = true
+			for _, k := range sortedKeys(def.Child) {
+				visit(def.Child[k], list)
+			}
+			delete(seen, typ)
+		}
+		for _, k := range sortedKeys(n.Child) {
+			visit(n.Child[k], list)
+		}
+	}
+	for _, k := range sortedKeys(c.root.Child) {
+		if p := c.root.Child[k]; p.IsParam {
+			visit(p, "")
+		}
+	}
+}
+
+// structural converts a generated schema into the form the API server
+// validates custom resources with.
+func structural(spec *apiextv1.JSONSchemaProps) (*structuralschema.Structural, error) {
+	var in apiextinternal.JSONSchemaProps
+	if err := apiextv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(spec, &in, nil); err != nil {
+		return nil, err
+	}
+	return structuralschema.NewStructural(&in)
+}
+
+// walkStructural calls fn for s and every schema nested in it.
+func walkStructural(s *structuralschema.Structural, fn func(*structuralschema.Structural)) {
+	if s == nil {
+		return
+	}
+	fn(s)
+	for _, k := range sortedKeys(s.Properties) {
+		p := s.Properties[k]
+		walkStructural(&p, fn)
+	}
+	walkStructural(s.Items, fn)
+	if s.AdditionalProperties != nil {
+		walkStructural(s.AdditionalProperties.Structural, fn)
+	}
+}
+
+// yamlAt returns the node of the values document at the field path of an
+// API server error, such as "backups[0].schedule" or "labels[app]", or the
+// deepest node found on the way.
+func yamlAt(n *yaml.Node, path string) *yaml.Node {
+	for path != "" {
+		n = resolveAlias(n)
+		path = strings.TrimPrefix(path, ".")
+		switch n.Kind {
+		case yaml.SequenceNode:
+			end := strings.Index(path, "]")
+			if !strings.HasPrefix(path, "[") || end < 0 {
+				return n
+			}
+			i, err := strconv.Atoi(path[1:end])
+			if err != nil || i < 0 || i >= len(n.Content) {
+				return n
+			}
+			n, path = n.Content[i], path[end+1:]
+		case yaml.MappingNode:
+			var next *yaml.Node
+			rest := ""
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				k := n.Content[i].Value
+				key := k
+				if strings.HasPrefix(path, "[") {
+					key = "[" + k + "]"
+				}
+				after, ok := strings.CutPrefix(path, key)
+				if !ok || (after != "" && after[0] != '.' && after[0] != '[') {
+					continue
+				}
+				// Keys may contain dots, so the longest match wins
+				if next == nil || len(after) < len(rest) {
+					next, rest = n.Content[i+1], after
+				}
+			}
+			if next == nil {
+				return n
+			}
+			n, path = next, rest
+		default:
+			return n
+		}
+	}
+	return n
+}
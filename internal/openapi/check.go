@@ -0,0 +1,608 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  Semantic checks of values and defaults                                     */
+/* -------------------------------------------------------------------------- */
+
+// Check type-checks the values document and every inline name=default against
+// the declared types and constraints of root. It also reports contradictory
+// constraints and params whose inline default disagrees with the values file,
+// which would otherwise only surface when Helm validates an install. The
+// @validate rules are compiled and evaluated against the values file, and
+// @immutable is rejected where the API server cannot enforce it.
+//
+// Check must run before PopulateDefaults, which copies YAML values into the
+// tree as defaults.
+func Check(root *Node, file string, data []byte) []*diag.Error {
+	c := &checker{root: root, file: file, lines: strings.Split(string(data), "\n"), expanding: map[string]bool{}}
+
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, k := range sortedKeys(n.Child) {
+			ch := n.Child[k]
+			if inherited(n, ch) {
+				continue // checked with its base type
+			}
+			if ch.IsParam || n != root {
+				c.constraints(ch)
+				c.conditions(ch)
+				c.lists(ch)
+				c.inlineDefault(ch)
+				c.examples(ch)
+			} else if ch.IsAlias() {
+				c.constraints(ch)
+				c.lists(ch)
+				c.examples(ch)
+			}
+			c.unions(ch)
+			walk(ch)
+		}
+	}
+	walk(root)
+	c.errs = append(c.errs, embedErrors(root)...)
+	c.errs = append(c.errs, aliasErrors(root)...)
+
+	var doc yaml.Node
+	var values *yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err == nil && len(doc.Content) > 0 {
+		if top := resolveAlias(doc.Content[0]); top.Kind == yaml.MappingNode {
+			values = top
+			for _, k := range sortedKeys(root.Child) {
+				if p := root.Child[k]; p.IsParam && missing(p, top) {
+					c.errorf(p.Pos.Find(p.Name), "%s: required, but not set in the values file", p.Name)
+				}
+			}
+			for i := 0; i+1 < len(top.Content); i += 2 {
+				p, ok := root.Child[top.Content[i].Value]
+				if !ok || !p.IsParam {
+					continue
+				}
+				c.value(p.TypeExpr, p, top.Content[i+1], source{at: c.yamlPos, yaml: true, direct: true})
+			}
+		}
+	}
+
+	c.immutables()
+
+	// Rules are evaluated on well-typed values only
+	if len(c.errs) > 0 {
+		values = nil
+	}
+	c.rules(values)
+
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		a, b := c.errs[i].Pos, c.errs[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return c.errs
+}
+
+type checker struct {
+	root      *Node
+	file      string
+	lines     []string
+	errs      []*diag.Error
+	expanding map[string]bool // aliases being checked, against cycles
+}
+
+func (c *checker) errorf(pos diag.Pos, format string, args ...interface{}) {
+	c.errs = append(c.errs, diag.Errorf(pos, format, args...).(*diag.Error))
+}
+
+func (c *checker) yamlPos(n *yaml.Node) diag.Pos {
+	return diag.At(c.file, c.lines, n.Line, n.Column)
+}
+
+// source describes where a checked value comes from.
+type source struct {
+	at     func(*yaml.Node) diag.Pos
+	yaml   bool // read from the values file rather than an inline default
+	direct bool // reached from a param through struct fields only
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+// constraints reports constraint combinations no value can satisfy.
+func (c *checker) constraints(n *Node) {
+	if n.Minimum != nil && n.Maximum != nil {
+		lo, hi := *n.Minimum, *n.Maximum
+		if lo > hi || (lo == hi && (n.ExclusiveMinimum || n.ExclusiveMaximum)) {
+			c.errorf(n.Pos, "%s: @minimum %v contradicts @maximum %v", n.Name, lo, hi)
+		}
+	}
+	if n.MinLength != nil && n.MaxLength != nil && *n.MinLength > *n.MaxLength {
+		c.errorf(n.Pos, "%s: @minLength %d is greater than @maxLength %d", n.Name, *n.MinLength, *n.MaxLength)
+	}
+	if n.MinItems != nil && n.MaxItems != nil && *n.MinItems > *n.MaxItems {
+		c.errorf(n.Pos, "%s: @minItems %d is greater than @maxItems %d", n.Name, *n.MinItems, *n.MaxItems)
+	}
+	if n.Pattern != "" {
+		if _, err := regexp.Compile(n.Pattern); err != nil {
+			c.errorf(n.Pos, "%s: invalid @pattern: %v", n.Name, err)
+		}
+	}
+	if n.MinProperties != nil && n.MaxProperties != nil && *n.MinProperties > *n.MaxProperties {
+		c.errorf(n.Pos, "%s: @minProperties %d is greater than @maxProperties %d", n.Name, *n.MinProperties, *n.MaxProperties)
+	}
+	if n.KeyPattern != "" {
+		if _, err := regexp.Compile(n.KeyPattern); err != nil {
+			c.errorf(n.Pos, "%s: invalid @keyPattern: %v", n.Name, err)
+		}
+	}
+	if te := strings.TrimPrefix(Underlying(c.root, n.TypeExpr), "*"); UnionMembers(te) != nil && !isIntOrString(te) &&
+		(len(n.Validations) > 0 || n.Immutable) {
+		c.errorf(n.Pos, "%s: {%s} is untyped in the CRD, so @validate and @immutable rules cannot see it", n.Name, n.TypeExpr)
+	}
+	key := mapKeyType(Underlying(c.root, n.TypeExpr))
+	if key == "" {
+		set := []bool{n.MinProperties != nil, n.MaxProperties != nil, n.KeyPattern != ""}
+		for i, tag := range []string{"minProperties", "maxProperties", "keyPattern"} {
+			if set[i] {
+				c.errorf(n.Pos, "%s: @%s needs a map, not {%s}", n.Name, tag, n.TypeExpr)
+			}
+		}
+	} else if d, ok := c.root.Child[key]; ok && !d.IsParam && keyEnum(c.root, key) == nil {
+		c.errorf(n.Pos.Find(key), "%s: map keys must be strings or string enums, not {%s}", n.Name, key)
+	}
+}
+
+// lists reports @listType and @listMapKey annotations the API server would
+// reject.
+func (c *checker) lists(n *Node) {
+	if n.ListType == "" {
+		return
+	}
+	te := strings.TrimPrefix(Underlying(c.root, n.TypeExpr), "*")
+	if !strings.HasPrefix(te, "[]") {
+		c.errorf(n.Pos, "%s: @listType needs a list, not {%s}", n.Name, n.TypeExpr)
+		return
+	}
+	elem := strings.TrimPrefix(strings.TrimSpace(te[2:]), "*")
+	def, ok := c.root.Child[elem]
+	object := ok && !def.IsParam && len(def.Enums) == 0
+	switch n.ListType {
+	case "set":
+		if !isScalar(c.root, elem) {
+			c.errorf(n.Pos, "%s: @listType set needs scalar items, not {%s}", n.Name, elem)
+		}
+	case "map":
+		if !object {
+			c.errorf(n.Pos, "%s: @listType map needs object items, not {%s}", n.Name, elem)
+			return
+		}
+		if len(n.ListMapKeys) == 0 {
+			c.errorf(n.Pos, "%s: @listType map needs a @listMapKey", n.Name)
+		}
+		for _, k := range n.ListMapKeys {
+			f, ok := def.Child[k]
+			switch {
+			case !ok:
+				c.errorf(n.Pos, "%s: @listMapKey %s is not a field of %s", n.Name, k, elem)
+			case !isScalar(c.root, Underlying(c.root, f.TypeExpr)):
+				c.errorf(f.Pos, "%s: @listMapKey %s must be a scalar, not {%s}", n.Name, k, f.TypeExpr)
+			case !f.IsRequired() && !f.HasDefaultVal:
+				c.errorf(f.Pos, "%s: @listMapKey %s must be required or have a default", n.Name, k)
+			}
+		}
+		return
+	}
+	if len(n.ListMapKeys) > 0 {
+		c.errorf(n.Pos, "%s: @listMapKey needs @listType map, not %s", n.Name, n.ListType)
+	}
+}
+
+// isScalar reports whether values of type t are scalars: primitives and enums.
+// Unions other than int|string are untyped in the CRD and do not count.
+func isScalar(root *Node, t string) bool {
+	t = Underlying(root, t)
+	switch t {
+	case aliasObject, aliasResources, aliasRequest, aliasLimit:
+		return false
+	}
+	if UnionMembers(t) != nil && !isIntOrString(t) {
+		return false
+	}
+	if e, ok := root.Child[t]; ok && !e.IsParam && len(e.Enums) > 0 {
+		return true
+	}
+	return isPrimitive(t)
+}
+
+// inlineDefault checks a name=default value against its own annotation.
+func (c *checker) inlineDefault(n *Node) {
+	if !n.HasDefaultVal || n.DefaultVal == "" {
+		return
+	}
+	var doc yaml.Node
+	pos := n.Pos.Find("}").Find("=" + n.DefaultVal)
+	pos.Col++
+	if err := yaml.Unmarshal([]byte(n.DefaultVal), &doc); err != nil || len(doc.Content) == 0 {
+		c.errorf(pos, "%s: default %s is not valid YAML", n.Name, n.DefaultVal)
+		return
+	}
+	c.value(n.TypeExpr, n, doc.Content[0], source{at: func(*yaml.Node) diag.Pos { return pos }})
+}
+
+// examples checks every @example of n like a value from the values file, so
+// an example that no longer fits the type or constraints fails the run.
+func (c *checker) examples(n *Node) {
+	for _, ex := range n.Examples {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(ex.Value), &doc); err != nil || len(doc.Content) == 0 {
+			c.errorf(ex.Pos, "%s: example is not valid YAML", n.Name)
+			continue
+		}
+		at := func(v *yaml.Node) diag.Pos {
+			return diag.At(c.file, c.lines, ex.Pos.Line+v.Line-1, ex.Pos.Col+v.Column-1)
+		}
+		c.value(n.TypeExpr, n, doc.Content[0], source{at: at, yaml: true})
+	}
+}
+
+// value checks v against the type expression typ; decl carries the
+// constraints. Values from the values file must use proper YAML types, while
+// inline defaults accept any scalar for string types. Inline defaults of
+// params and of fields reached through structs are compared with the YAML
+// value they describe.
+func (c *checker) value(typ string, decl *Node, v *yaml.Node, src source) {
+	v = resolveAlias(v)
+	if v.Tag == "!!null" {
+		return
+	}
+	name, at := decl.Name, src.at
+	if src.yaml && src.direct && decl.HasDefaultVal {
+		c.compareDefault(decl, v, at)
+	}
+	typ = strings.TrimPrefix(strings.TrimSpace(typ), "*")
+	if typ == "" {
+		typ = "string"
+	}
+
+	switch {
+	case strings.HasPrefix(typ, "[]"):
+		if v.Kind != yaml.SequenceNode {
+			c.errorf(at(v), "%s: expected a list for {%s}, got %s", name, typ, describeNode(v))
+			return
+		}
+		c.checkItems(decl, v, at)
+		c.checkUnique(decl, typ[2:], v, at)
+		elem := &Node{Name: name}
+		src.direct = false
+		for _, e := range v.Content {
+			c.value(typ[2:], elem, e, src)
+		}
+		return
+	case strings.HasPrefix(typ, "map[") && strings.Contains(typ, "]"):
+		if v.Kind != yaml.MappingNode {
+			c.errorf(at(v), "%s: expected a mapping for {%s}, got %s", name, typ, describeNode(v))
+			return
+		}
+		c.checkProperties(decl, mapKeyType(typ), v, at)
+		elemType := typ[strings.Index(typ, "]")+1:]
+		src.direct = false
+		for i := 0; i+1 < len(v.Content); i += 2 {
+			c.value(elemType, &Node{Name: name + "." + v.Content[i].Value}, v.Content[i+1], src)
+		}
+		return
+	}
+
+	if def, ok := c.root.Child[typ]; ok && !def.IsParam {
+		switch {
+		case len(def.Enums) > 0:
+			if v.Kind != yaml.ScalarNode || !contains(def.Enums, v.Value) {
+				c.errorf(at(v), "%s: %s is not a valid %s (want one of %s)", name, describeNode(v), typ, strings.Join(def.Enums, ", "))
+				return
+			}
+			typ = strings.TrimSpace(def.TypeExpr)
+		case len(def.Child) > 0 || def.TypeExpr == "struct":
+			c.structValue(typ, def, decl, v, src)
+			return
+		case def.IsAlias():
+			if !c.expanding[typ] { // cycles are reported by aliasErrors
+				c.expanding[typ] = true
+				src.direct = false // compared with the default above
+				c.value(def.TypeExpr, withAlias(def, decl), v, src)
+				delete(c.expanding, typ)
+			}
+			return
+		}
+	}
+	c.scalar(typ, decl, v, src)
+}
+
+func (c *checker) structValue(typ string, def, decl *Node, v *yaml.Node, src source) {
+	if v.Kind != yaml.MappingNode {
+		c.errorf(src.at(v), "%s: expected a mapping for {%s}, got %s", decl.Name, typ, describeNode(v))
+		return
+	}
+	if src.yaml {
+		for _, k := range sortedKeys(def.Child) {
+			if f := def.Child[k]; missing(f, v) {
+				c.errorf(src.at(v), "%s: missing required field %s of {%s}", decl.Name, f.Name, typ)
+			}
+		}
+	}
+	for i := 0; i+1 < len(v.Content); i += 2 {
+		f, ok := def.Child[v.Content[i].Value]
+		if !ok {
+			continue // unknown keys are reported by the README validator
+		}
+		c.value(f.TypeExpr, f, v.Content[i+1], src)
+	}
+}
+
+// missing reports whether the required param or field n has neither a key in
+// the mapping m nor an inline default to fall back on.
+func missing(n *Node, m *yaml.Node) bool {
+	if !n.IsRequired() || n.HasDefaultVal {
+		return false
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == n.Name {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *checker) scalar(typ string, decl *Node, v *yaml.Node, src source) {
+	name, at := decl.Name, src.at
+	want := func(what string) {
+		c.errorf(at(v), "%s: expected %s for {%s}, got %s", name, what, typ, describeNode(v))
+	}
+
+	if members := UnionMembers(typ); members != nil {
+		m := unionMember(members, v, src)
+		if m == "" {
+			want(strings.Join(members, " or "))
+			return
+		}
+		c.scalar(m, decl, v, src)
+		return
+	}
+
+	switch typ {
+	case "int", "int32", "int64":
+		if v.Tag != "!!int" {
+			want("an integer")
+			return
+		}
+		n, err := strconv.ParseInt(v.Value, 0, 64)
+		if err != nil || (typ == "int32" && (n < math.MinInt32 || n > math.MaxInt32)) {
+			c.errorf(at(v), "%s: %s is out of range for {%s}", name, v.Value, typ)
+			return
+		}
+		c.checkNumber(decl, float64(n), v, at)
+	case "float32", "float64":
+		if v.Tag != "!!int" && v.Tag != "!!float" {
+			want("a number")
+			return
+		}
+		f, err := strconv.ParseFloat(v.Value, 64)
+		if err != nil {
+			want("a number")
+			return
+		}
+		c.checkNumber(decl, f, v, at)
+	case "bool":
+		if v.Tag != "!!bool" {
+			want("a boolean")
+		}
+	case aliasQuantity:
+		if v.Kind != yaml.ScalarNode || (v.Tag != "!!str" && v.Tag != "!!int" && v.Tag != "!!float") {
+			want("a quantity")
+		} else if _, err := resource.ParseQuantity(v.Value); err != nil {
+			c.errorf(at(v), "%s: %q is not a valid quantity", name, v.Value)
+		}
+	case aliasDuration:
+		if v.Kind != yaml.ScalarNode {
+			want("a duration")
+		} else if _, err := time.ParseDuration(v.Value); err != nil {
+			c.errorf(at(v), "%s: %q is not a valid duration", name, v.Value)
+		}
+	case aliasTime:
+		if v.Kind != yaml.ScalarNode {
+			want("an RFC 3339 time")
+		} else if _, err := time.Parse(time.RFC3339, v.Value); err != nil {
+			c.errorf(at(v), "%s: %q is not a valid RFC 3339 time", name, v.Value)
+		}
+	case aliasEmptyObject:
+		if v.Kind != yaml.MappingNode {
+			want("a mapping")
+		}
+	default:
+		if typ != "string" && !IsStringFormat(typ) {
+			return // object aliases, external and undefined types
+		}
+		if v.Kind != yaml.ScalarNode || (src.yaml && v.Tag != "!!str") {
+			want("a string")
+			return
+		}
+		c.checkString(decl, v, at)
+	}
+}
+
+// unionMember returns the first of the union members that v is a value of,
+// or "". Like string types, a union with string takes any scalar as an
+// inline default.
+func unionMember(members []string, v *yaml.Node, src source) string {
+	if v.Kind != yaml.ScalarNode {
+		return ""
+	}
+	for _, m := range members {
+		switch m {
+		case "bool":
+			if v.Tag == "!!bool" {
+				return m
+			}
+		case "int", "int32", "int64":
+			if v.Tag == "!!int" {
+				return m
+			}
+		case "float32", "float64":
+			if v.Tag == "!!int" || v.Tag == "!!float" {
+				return m
+			}
+		case "string":
+			if v.Tag == "!!str" || !src.yaml {
+				return m
+			}
+		}
+	}
+	return ""
+}
+
+func (c *checker) checkNumber(decl *Node, f float64, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	if m := decl.Minimum; m != nil && (f < *m || (decl.ExclusiveMinimum && f == *m)) {
+		c.errorf(at(v), "%s: %s violates @minimum %v", decl.Name, v.Value, *m)
+	}
+	if m := decl.Maximum; m != nil && (f > *m || (decl.ExclusiveMaximum && f == *m)) {
+		c.errorf(at(v), "%s: %s violates @maximum %v", decl.Name, v.Value, *m)
+	}
+}
+
+func (c *checker) checkString(decl *Node, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	l := int64(len([]rune(v.Value)))
+	if m := decl.MinLength; m != nil && l < *m {
+		c.errorf(at(v), "%s: %q is shorter than @minLength %d", decl.Name, v.Value, *m)
+	}
+	if m := decl.MaxLength; m != nil && l > *m {
+		c.errorf(at(v), "%s: %q is longer than @maxLength %d", decl.Name, v.Value, *m)
+	}
+	if decl.Pattern != "" {
+		if re, err := regexp.Compile(decl.Pattern); err == nil && !re.MatchString(v.Value) {
+			c.errorf(at(v), "%s: %q does not match @pattern %s", decl.Name, v.Value, decl.Pattern)
+		}
+	}
+}
+
+func (c *checker) checkItems(decl *Node, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	n := int64(len(v.Content))
+	if m := decl.MinItems; m != nil && n < *m {
+		c.errorf(at(v), "%s: %d item(s) is fewer than @minItems %d", decl.Name, n, *m)
+	}
+	if m := decl.MaxItems; m != nil && n > *m {
+		c.errorf(at(v), "%s: %d item(s) is more than @maxItems %d", decl.Name, n, *m)
+	}
+}
+
+// checkUnique reports duplicate items of a set and items of a map list that
+// share their @listMapKey values.
+func (c *checker) checkUnique(decl *Node, elem string, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	seen := map[string]bool{}
+	for _, item := range v.Content {
+		item = resolveAlias(item)
+		var key string
+		switch {
+		case decl.ListType == "set" && item.Kind == yaml.ScalarNode:
+			key = item.Value
+		case decl.ListType == "map" && item.Kind == yaml.MappingNode:
+			def := c.root.Child[strings.TrimPrefix(Underlying(c.root, elem), "*")]
+			if def == nil {
+				continue // reported by lists
+			}
+			var parts []string
+			for _, k := range decl.ListMapKeys {
+				val := "<unset>"
+				var d yaml.Node
+				if f := def.Child[k]; f != nil && f.HasDefaultVal && yaml.Unmarshal([]byte(f.DefaultVal), &d) == nil && len(d.Content) > 0 {
+					val = d.Content[0].Value
+				}
+				for i := 0; i+1 < len(item.Content); i += 2 {
+					if item.Content[i].Value == k {
+						val = resolveAlias(item.Content[i+1]).Value
+					}
+				}
+				parts = append(parts, k+"="+val)
+			}
+			key = strings.Join(parts, ", ")
+		default:
+			continue
+		}
+		if seen[key] {
+			if decl.ListType == "set" {
+				c.errorf(at(item), "%s: duplicate item %s", decl.Name, describeNode(item))
+			} else {
+				c.errorf(at(item), "%s: duplicate item with %s", decl.Name, key)
+			}
+		}
+		seen[key] = true
+	}
+}
+
+func (c *checker) checkProperties(decl *Node, key string, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	n := int64(len(v.Content) / 2)
+	if m := decl.MinProperties; m != nil && n < *m {
+		c.errorf(at(v), "%s: %d key(s) is fewer than @minProperties %d", decl.Name, n, *m)
+	}
+	if m := decl.MaxProperties; m != nil && n > *m {
+		c.errorf(at(v), "%s: %d key(s) is more than @maxProperties %d", decl.Name, n, *m)
+	}
+	e := keyEnum(c.root, key)
+	re, _ := regexp.Compile(decl.KeyPattern)
+	for i := 0; i+1 < len(v.Content); i += 2 {
+		k := v.Content[i]
+		if e != nil && !contains(e.Enums, k.Value) {
+			c.errorf(at(k), "%s: key %q is not a valid %s (want one of %s)", decl.Name, k.Value, key, strings.Join(e.Enums, ", "))
+		}
+		if decl.KeyPattern != "" && re != nil && !re.MatchString(k.Value) {
+			c.errorf(at(k), "%s: key %q does not match @keyPattern %s", decl.Name, k.Value, decl.KeyPattern)
+		}
+	}
+}
+
+// compareDefault reports an inline default that differs from the YAML value.
+// The inline default wins in the schema, so the two would silently diverge.
+func (c *checker) compareDefault(decl *Node, v *yaml.Node, at func(*yaml.Node) diag.Pos) {
+	var inline, actual interface{}
+	if err := yaml.Unmarshal([]byte(decl.DefaultVal), &inline); err != nil {
+		return // reported by inlineDefault
+	}
+	if err := v.Decode(&actual); err != nil {
+		return
+	}
+	equal := reflect.DeepEqual(inline, actual)
+	if !equal && v.Kind == yaml.ScalarNode {
+		// Inline defaults of string types need not be quoted
+		equal = fmt.Sprint(inline) == fmt.Sprint(actual)
+	}
+	if !equal {
+		c.errorf(at(v), "%s: value %s disagrees with the inline default %s at %s", decl.Name, describeNode(v), decl.DefaultVal, decl.Pos)
+	}
+}
+
+func describeNode(v *yaml.Node) string {
+	switch v.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	if v.Tag == "!!str" {
+		return strconv.Quote(v.Value)
+	}
+	return v.Value
+}
@@ -0,0 +1,610 @@
+package openapi
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// checkYAML runs Check on content and returns "line:col: msg" per problem,
+// with the temporary file name replaced by "values.yaml".
+func checkYAML(t *testing.T, content string) []string {
+	t.Helper()
+	tmp := writeTempFile(content)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	var out []string
+	for _, e := range Check(Build(rows), tmp, []byte(content)) {
+		msg := strings.TrimPrefix(e.Pos.String(), tmp+":") + ": " + e.Msg
+		out = append(out, strings.ReplaceAll(msg, tmp, "values.yaml"))
+	}
+	return out
+}
+
+func TestCheckExamplesAreClean(t *testing.T) {
+	for _, name := range []string{"monitoring.yaml", "postgres.yaml", "virtual-machine.yaml"} {
+		data, err := os.ReadFile("../../examples/" + name)
+		require.NoError(t, err)
+		require.Empty(t, checkYAML(t, string(data)), name)
+	}
+}
+
+func TestCheckYAMLValues(t *testing.T) {
+	const yaml = `## @enum {string} Size - Size
+## @value small
+## @value large
+
+## @typedef {struct} Db - Db
+## @field {quantity} storage - Storage
+## @field {[]int} ports - Ports
+## @field {map[string]bool} flags - Flags
+
+## @param {int} replicas - Replicas
+## @param {Size} size - Size
+## @param {Db} db - Db
+## @param {string} host - Host
+## @param {*time} since - Since
+replicas: "three"
+size: medium
+db:
+  storage: 10Qi
+  ports: [80, "443"]
+  flags:
+    a: yes-please
+host: 42
+since: null
+`
+	require.Equal(t, []string{
+		`15:11: replicas: expected an integer for {int}, got "three"`,
+		`16:7: size: "medium" is not a valid Size (want one of small, large)`,
+		`18:12: storage: "10Qi" is not a valid quantity`,
+		`19:15: ports: expected an integer for {int}, got "443"`,
+		`21:8: flags.a: expected a boolean for {bool}, got "yes-please"`,
+		`22:7: host: expected a string for {string}, got 42`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckConstraints(t *testing.T) {
+	const yaml = `## @param {int} replicas - Replicas
+## @minimum 1
+## @maximum 3
+## @param {string} name - Name
+## @maxLength 3
+## @pattern ^[a-z]+$
+## @param {[]string} tags - Tags
+## @minItems 1
+## @param {float64} ratio - Ratio
+## @minimum 0
+## @exclusiveMinimum
+replicas: 5
+name: Abcd
+tags: []
+ratio: 0
+`
+	require.Equal(t, []string{
+		`12:11: replicas: 5 violates @maximum 3`,
+		`13:7: name: "Abcd" is longer than @maxLength 3`,
+		`13:7: name: "Abcd" does not match @pattern ^[a-z]+$`,
+		`14:7: tags: 0 item(s) is fewer than @minItems 1`,
+		`15:8: ratio: 0 violates @minimum 0`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckContradictoryConstraints(t *testing.T) {
+	const yaml = `## @param {int} a - A
+## @minimum 5
+## @maximum 3
+## @param {int} b - B
+## @minimum 3
+## @maximum 3
+## @exclusiveMaximum
+## @param {string} c - C
+## @minLength 4
+## @maxLength 2
+## @param {[]int} d - D
+## @minItems 2
+## @maxItems 1
+## @param {string} e - E
+## @pattern [a-
+`
+	require.Equal(t, []string{
+		`1:4: a: @minimum 5 contradicts @maximum 3`,
+		`4:4: b: @minimum 3 contradicts @maximum 3`,
+		`8:4: c: @minLength 4 is greater than @maxLength 2`,
+		`11:4: d: @minItems 2 is greater than @maxItems 1`,
+		"14:4: e: invalid @pattern: error parsing regexp: missing closing ]: `[a-`",
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckInlineDefaults(t *testing.T) {
+	const yaml = `## @typedef {struct} Db - Db
+## @field {int} port=5432 - Port
+## @field {string} user=admin - User
+## @minLength 6
+
+## @param {int} replicas=two - Replicas
+## @param {duration} every="5x" - Every
+## @param {string} version=15 - Unquoted string defaults are fine
+## @param {Db} db - Db
+## @param {int} workers=2 - Workers
+db:
+  port: 5433
+workers: 2
+version: "15"
+`
+	require.Equal(t, []string{
+		`3:25: user: "admin" is shorter than @minLength 6`,
+		`6:26: replicas: expected an integer for {int}, got "two"`,
+		`7:28: every: "5x" is not a valid duration`,
+		`12:9: port: value 5433 disagrees with the inline default 5432 at values.yaml:2:4`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckExamples(t *testing.T) {
+	const yaml = `## @typedef {struct} Db - Db
+## @field {int} port - Port
+## @maximum 65535
+## @example 70000
+
+## @param {Db} db - Db
+## @example
+##   port: "5432"
+## @param {[]string} tags - Tags
+## @maxItems 1
+## @example [a, b]
+## @param {duration} every - Every
+## @example 5m
+## @example {
+db:
+  port: 1
+every: 1m
+`
+	require.Equal(t, []string{
+		`4:13: port: 70000 violates @maximum 65535`,
+		`8:12: port: expected an integer for {int}, got "5432"`,
+		`11:13: tags: 2 item(s) is more than @maxItems 1`,
+		`14:13: every: example is not valid YAML`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckDottedParams(t *testing.T) {
+	const yaml = `## @param {int} postgres.persistence.size - Size
+## @minimum 1
+## @param {string} backups[].name - Name
+postgres:
+  persistence:
+    size: 0
+  extra: kept for the subchart
+backups:
+  - name: 1
+`
+	require.Equal(t, []string{
+		`6:11: size: 0 violates @minimum 1`,
+		`9:11: name: expected a string for {string}, got 1`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckRequired(t *testing.T) {
+	const yaml = `## @typedef {struct} Db - Db
+## @field {string} host - Host
+## @field {int} port=5432 - Port
+## @field {string} [user] - User
+## @field {[]string} opts - Options
+## @required
+
+## @param {Db} db - Db
+## @example
+##   port: 1
+## @param {string} name - Name
+## @param {string} [zone] - Zone
+## @param {[]Db} replicas - Replicas
+db:
+  host: x
+replicas:
+  - host: y
+    opts: []
+`
+	require.Equal(t, []string{
+		`10:6: db: missing required field host of {Db}`,
+		`10:6: db: missing required field opts of {Db}`,
+		`11:20: name: required, but not set in the values file`,
+		`15:3: db: missing required field opts of {Db}`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckValidate(t *testing.T) {
+	const yaml = `## @typedef {struct} Quorum - Quorum
+## @validate self.min <= self.max - min must not exceed max
+## @field {int} min - Min
+## @field {int} max - Max
+
+## @param {[]Quorum} quorums - Quorums
+## @param {int} size - Size
+## @validate self < 100 - size must be below 100
+## @param {map[string]string} labels - Labels
+## @validate self.all(k, k.startsWith("app")) - labels must start with app
+quorums:
+  - min: 0
+    max: 1
+  - min: 2
+    max: 1
+size: 100
+labels:
+  app.kubernetes.io/name: x
+  team: y
+`
+	require.Equal(t, []string{
+		`14:5: quorums[1]: min must not exceed max`,
+		`16:7: size: size must be below 100`,
+		`18:3: labels: labels must start with app`,
+	}, checkYAML(t, yaml))
+
+	const broken = `## @param {int} size - Size
+## @validate self.foo( - broken
+## @validate self > 0
+size: 0
+`
+	errs := checkYAML(t, broken)
+	require.Len(t, errs, 1)
+	require.True(t, strings.HasPrefix(errs[0], `2:14: invalid @validate rule "self.foo(": `), errs[0])
+}
+
+func TestCheckImmutableInList(t *testing.T) {
+	const yaml = `## @typedef {struct} Disk - Disk
+## @field {string} image - Image
+## @immutable
+
+## @param {Disk} disk - Disk
+## @param {[]Disk} extraDisks - Extra disks
+## @param {[]string} tags - Tags
+## @immutable
+disk:
+  image: ubuntu
+extraDisks: []
+tags: []
+`
+	require.Equal(t, []string{
+		`2:20: image: @immutable is not allowed inside the list extraDisks, whose items have no old value to compare with`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckConditions(t *testing.T) {
+	const yaml = `## @typedef {struct} Backup - Backup
+## @field {bool} enabled - Enable backups
+## @field {[]string} targets - Targets
+
+## @param {Backup} backup - Backup
+## @param {string} s3Bucket - S3 bucket
+## @requiredIf backup.enabled=true
+## @param {int} replicas - Replicas
+## @requiredIf backup.targets=x
+## @param {int} port - Port
+## @visibleIf backup.enabled=yes
+## @param {int} size - Size
+## @visibleIf storage=large
+backup:
+  enabled: true
+  targets: []
+s3Bucket: ""
+replicas: 1
+port: 80
+size: 1
+`
+	require.Equal(t, []string{
+		`9:16: replicas: invalid condition backup.targets=x: backup.targets is a {[]string}; conditions test bool, number, string and enum values`,
+		`11:15: port: invalid condition backup.enabled=yes: yes is not a valid {bool}`,
+		`13:15: size: invalid condition storage=large: unknown param or field storage`,
+	}, checkYAML(t, yaml))
+
+	const unset = `## @param {bool} external - External access
+## @param {[]int} externalPorts - Ports
+## @requiredIf external=true
+external: true
+externalPorts: []
+`
+	require.Equal(t, []string{
+		`5:1: externalPorts is required when external is true`,
+	}, checkYAML(t, unset))
+
+	// Without a key, at the annotation
+	const missing = `## @typedef {struct} Backup - Backup
+## @field {string} provider - Provider
+## @field {string} [s3Bucket] - S3 bucket
+## @requiredIf provider=s3
+
+## @param {bool} external - External access
+## @param {*int} [port] - Port
+## @requiredIf external=true
+## @param {Backup} backup - Backup
+external: true
+backup:
+  provider: s3
+`
+	require.Equal(t, []string{
+		`3:21: backup: s3Bucket is required when provider is s3`,
+		`7:19: port is required when external is true`,
+	}, checkYAML(t, missing))
+}
+
+func TestCheckMapKeys(t *testing.T) {
+	const yaml = `## @enum {string} Size - Size
+## @value small
+## @value large
+## @typedef {struct} Disk - Disk
+## @field {string} name - Name
+
+## @param {map[string]string} users - Users
+## @keyPattern ^[a-z]+$
+## @maxProperties 1
+## @param {map[Size]int} presets - Presets
+## @minProperties 3
+## @maxProperties 2
+## @param {map[Disk]int} disks - Disks
+## @param {[]string} tags - Tags
+## @keyPattern ^[a-z]+$
+users:
+  alice: x
+  Bob: y
+presets:
+  huge: 1
+disks: {}
+tags: []
+`
+	require.Equal(t, []string{
+		`10:4: presets: @minProperties 3 is greater than @maxProperties 2`,
+		`13:16: disks: map keys must be strings or string enums, not {Disk}`,
+		`14:4: tags: @keyPattern needs a map, not {[]string}`,
+		`17:3: users: 2 key(s) is more than @maxProperties 1`,
+		`18:3: users: key "Bob" does not match @keyPattern ^[a-z]+$`,
+		`20:3: presets: 1 key(s) is fewer than @minProperties 3`,
+		`20:3: presets: key "huge" is not a valid Size (want one of small, large)`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckListTypes(t *testing.T) {
+	const yaml = `## @typedef {struct} Port - Port
+## @field {string} protocol="TCP" - Protocol
+## @field {int} port - Port
+## @field {string} [name] - Name
+
+## @param {[]Port} ports - Ports
+## @listMapKey port
+## @listMapKey protocol
+## @param {[]Port} named - Named ports
+## @listMapKey name
+## @listMapKey host
+## @param {[]string} sshKeys - SSH keys
+## @uniqueItems
+## @param {[]Port} set - Set of ports
+## @uniqueItems
+## @param {string} single - Single
+## @listType set
+ports:
+  - port: 80
+  - port: 80
+    protocol: UDP
+  - port: 80
+    protocol: TCP
+named: []
+sshKeys:
+  - a
+  - b
+  - a
+set: []
+single: x
+`
+	require.Equal(t, []string{
+		`4:4: named: @listMapKey name must be required or have a default`,
+		`9:4: named: @listMapKey host is not a field of Port`,
+		`14:4: set: @listType set needs scalar items, not {Port}`,
+		`16:4: single: @listType needs a list, not {string}`,
+		`22:5: ports: duplicate item with port=80, protocol=TCP`,
+		`28:5: sshKeys: duplicate item "a"`,
+	}, checkYAML(t, yaml))
+
+	tmp := writeTempFile("## @param {[]string} tags - Tags\n## @listType bag\n")
+	defer os.Remove(tmp)
+	_, err := Parse(tmp)
+	require.ErrorContains(t, err, `2:14: invalid @listType "bag" for "tags" (want set, map or atomic)`)
+}
+
+func TestCheckUnions(t *testing.T) {
+	const yaml = `## @param {intOrString} port=8080 - Port
+## @param {intOrString} [targetPort] - Target port
+## @minimum 1
+## @param {[]bool|string} [tls] - TLS settings
+## @param {int32|string} [big] - Big
+## @param {bool|float64} [ratio] - Ratio
+## @validate self != 0.5
+port: http
+targetPort: 0
+tls:
+  - true
+  - secret
+  - {}
+big: 3000000000
+ratio: "0.5"
+`
+	require.Equal(t, []string{
+		`6:4: ratio: {bool|float64} is untyped in the CRD, so @validate and @immutable rules cannot see it`,
+		`8:7: port: value "http" disagrees with the inline default 8080 at values.yaml:1:4`,
+		`9:13: targetPort: 0 violates @minimum 1`,
+		`13:5: tls: expected bool or string for {bool|string}, got a mapping`,
+		`14:6: big: 3000000000 is out of range for {int32}`,
+		`15:8: ratio: expected bool or float64 for {bool|float64}, got "0.5"`,
+	}, checkYAML(t, yaml))
+}
+
+func TestCheckUnionTypedef(t *testing.T) {
+	const yaml = `## @typedef {struct} S3Target - S3 bucket
+## @field {string} bucket - Bucket name
+## @enum {string} Region - Region
+## @value eu
+
+## @union {BackupTarget} - Backup target
+## @variant s3 S3Target
+## @variant gcs Region
+## @field {string} [s3] - Shadows the s3 member
+
+## @param {[]BackupTarget} targets - Targets
+targets:
+  - type: azure
+`
+	require.Equal(t, []string{
+		`8:17: BackupTarget: @variant gcs needs a struct typedef, not Region`,
+		`9:4: BackupTarget: field s3 is the member of @variant s3`,
+		`13:11: type: "azure" is not a valid BackupTargetType (want one of s3, gcs)`,
+	}, checkYAML(t, yaml))
+
+	require.Equal(t, []string{
+		`11:5: targets[1]: exactly the member named by type must be set`,
+	}, checkYAML(t, `## @typedef {struct} S3Target - S3 bucket
+## @field {string} bucket - Bucket name
+## @union {BackupTarget} - Backup target
+## @variant s3 S3Target
+## @variant gcs S3Target
+## @param {[]BackupTarget} targets - Targets
+targets:
+  - type: s3
+    s3:
+      bucket: a
+  - type: gcs
+    s3:
+      bucket: b
+`))
+
+	for content, want := range map[string]string{
+		"## @variant s3 S3Target\n":                                         `1:4: @variant must follow a @union`,
+		"## @union {T} - T discriminator=kind\n## @variant kind S3Target\n": `2:13: @variant kind of "T" has the name of its discriminator`,
+		"## @union {T} - T\n## @variant s3 S3Target\n## @variant s3 GCS\n":  `3:13: duplicate @variant s3 for "T"`,
+	} {
+		tmp := writeTempFile(content)
+		_, err := Parse(tmp)
+		os.Remove(tmp)
+		require.ErrorContains(t, err, want)
+	}
+}
+
+func TestCheckEmbeddedTypedefs(t *testing.T) {
+	const yaml = `## @typedef {struct} Base - Base
+## @field {bool} enabled - Enabled
+## @field {int} [port] - Port
+## @maximum 100
+## @typedef {struct} Other - Other
+## @field {bool} enabled - Enabled
+## @enum {string} Size - Size
+## @value small
+
+## @typedef {struct} Replica - Replica @extends Base, Other
+## @field {int} [port] - Shadows the port of Base
+## @typedef {struct} Proxy - Proxy
+## @embed {Size}
+## @embed {Missing}
+
+## @param {Replica} replica - Replica
+## @param {Proxy} proxy - Proxy
+replica:
+  enabled: true
+proxy: {}
+`
+	require.Equal(t, []string{
+		`10:55: Replica: field enabled is inherited from both Base and Other`,
+		`11:18: Replica: field port is also inherited from Base`,
+		`13:12: Proxy: Size is not a struct typedef and cannot be embedded`,
+		`14:12: Proxy: undefined type "Missing"`,
+	}, checkYAML(t, yaml))
+
+	// Inherited fields are checked like declared ones
+	require.Equal(t, []string{
+		`7:9: port: 200 violates @maximum 100`,
+	}, checkYAML(t, `## @typedef {struct} Base - Base
+## @field {int} [port] - Port
+## @maximum 100
+## @typedef {struct} Replica - Replica @extends Base
+## @param {Replica} replica - Replica
+replica:
+  port: 200
+`))
+
+	const cycle = `## @typedef {struct} A @extends B
+## @field {int} a - A
+## @typedef {struct} B - B
+## @embed {C}
+## @typedef {struct} C - C @extends A
+## @param {A} a - A
+a:
+  a: 1
+`
+	require.Equal(t, []string{
+		`5:37: C: @extends cycle C → A → B → C`,
+	}, checkYAML(t, cycle))
+	tmp := writeTempFile(cycle)
+	defer os.Remove(tmp)
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	_, _, err = NewGen("values", "g", "v1").Generate(Build(rows))
+	require.ErrorContains(t, err, ":5:37: C: @extends cycle C → A → B → C")
+
+	for content, want := range map[string]string{
+		"## @embed {Base}\n": `1:4: @embed must follow a @typedef`,
+		"## @typedef {struct} T - T\n## @param {int} p - P\n## @embed {Base}\n": `3:4: @embed must follow a @typedef`,
+		"## @typedef {struct} T - T @extends Base\n## @embed {Base}\n":          `2:12: duplicate @extends Base for "T"`,
+	} {
+		tmp := writeTempFile(content)
+		_, err := Parse(tmp)
+		os.Remove(tmp)
+		require.ErrorContains(t, err, want)
+	}
+}
+
+func TestCheckTypeAliases(t *testing.T) {
+	const yaml = `## @typedef {string} Hostname - DNS name
+## @pattern ^[a-z.]+$
+## @maxLength 10
+## @typedef {[]Hostname} Hostnames - DNS names
+## @uniqueItems
+## @typedef {map[string]int} Ports - Ports
+## @maximum 5
+## @typedef {int} Port - Port
+## @minimum 10
+## @maximum 5
+## @typedef {[]B} A - A
+## @typedef {A} B - B
+
+## @param {Hostname} host - Host
+## @param {Hostname} short - Shorter host
+## @maxLength 3
+## @param {Hostnames} replicas - Replicas
+## @param {Ports} [ports] - Ports
+## @minProperties 1
+host: DB
+short: abcd
+replicas: [a, a]
+ports: {}
+`
+	require.Equal(t, []string{
+		`8:4: Port: @minimum 10 contradicts @maximum 5`,
+		`11:19: A: @typedef cycle A → B → A`,
+		`12:17: B: @typedef cycle B → A → B`,
+		`20:7: host: "DB" does not match @pattern ^[a-z.]+$`,
+		`21:8: short: "abcd" is longer than @maxLength 3`,
+		`22:15: replicas: duplicate item "a"`,
+		`23:8: ports: 0 key(s) is fewer than @minProperties 1`,
+	}, checkYAML(t, yaml))
+
+	for content, want := range map[string]string{
+		"## @typedef {*string} Name - Name\n":                           `1:13: @typedef Name cannot be a pointer, use {*Name} where it is referenced`,
+		"## @typedef {string} Name @extends Base\n":                     `1:27: @typedef Name is not a struct and cannot @extends`,
+		"## @typedef {string} Name - Name\n## @required\n":              `2:4: @required applies to params and fields, not to the @typedef Name`,
+		"## @typedef {[]string} Names - Names\n## @field {int} a - A\n": `2:4: @field a cannot belong to the @typedef Names, which is not a struct`,
+	} {
+		tmp := writeTempFile(content)
+		_, err := Parse(tmp)
+		os.Remove(tmp)
+		require.ErrorContains(t, err, want)
+	}
+}
@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"gopkg.in/yaml.v3"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  @requiredIf and @visibleIf conditions                                      */
+/* -------------------------------------------------------------------------- */
+
+// Condition is the path=value test of a @requiredIf or @visibleIf. Path is
+// relative to the object holding the param or field, which is the values
+// root for top-level params.
+type Condition struct {
+	Path  []string
+	Value string   // YAML scalar
+	Pos   diag.Pos // Location of the path
+}
+
+func newCondition(path, value string, pos diag.Pos) *Condition {
+	return &Condition{Path: strings.Split(path, "."), Value: value, Pos: pos.Find(" " + path).Find(path)}
+}
+
+func (c *Condition) String() string {
+	return strings.Join(c.Path, ".") + "=" + c.Value
+}
+
+// resolve returns the value of the condition typed after the param or field
+// it tests, which must be a bool, number, string or enum below the object
+// parent.
+func (c *Condition) resolve(parent *Node) (interface{}, error) {
+	root := parent
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	obj, n := parent, (*Node)(nil)
+	for i, seg := range c.Path {
+		if i > 0 {
+			typ := strings.TrimPrefix(Underlying(root, n.TypeExpr), "*")
+			def, ok := root.Child[typ]
+			if !ok || len(def.Child) == 0 || (def.IsParam && def != n) {
+				return nil, fmt.Errorf("%s is not an object", strings.Join(c.Path[:i], "."))
+			}
+			obj = def
+		}
+		n = obj.Child[seg]
+		if n == nil || (obj == root && !n.IsParam) {
+			return nil, fmt.Errorf("unknown param or field %s", strings.Join(c.Path[:i+1], "."))
+		}
+	}
+
+	typ := strings.TrimPrefix(Underlying(root, n.TypeExpr), "*")
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(c.Value), &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.ScalarNode {
+		return nil, fmt.Errorf("%s is not a scalar", c.Value)
+	}
+	v := doc.Content[0]
+	if def, ok := root.Child[typ]; ok && !def.IsParam && len(def.Enums) > 0 {
+		if !contains(def.Enums, v.Value) {
+			return nil, fmt.Errorf("%s is not a valid %s (want one of %s)", c.Value, typ, strings.Join(def.Enums, ", "))
+		}
+		typ = strings.TrimSpace(def.TypeExpr)
+	}
+	switch typ {
+	case "bool":
+		if b, err := strconv.ParseBool(v.Value); err == nil && v.Tag == "!!bool" {
+			return b, nil
+		}
+	case "int", "int32", "int64":
+		if i, err := strconv.ParseInt(v.Value, 10, 64); err == nil && v.Tag == "!!int" {
+			return i, nil
+		}
+	case "float32", "float64":
+		if f, err := strconv.ParseFloat(v.Value, 64); err == nil && (v.Tag == "!!int" || v.Tag == "!!float") {
+			return f, nil
+		}
+	case "string":
+		return v.Value, nil
+	default:
+		return nil, fmt.Errorf("%s is a {%s}; conditions test bool, number, string and enum values", strings.Join(c.Path, "."), typ)
+	}
+	return nil, fmt.Errorf("%s is not a valid {%s}", c.Value, typ)
+}
+
+// cel returns the CEL expression of the condition, evaluated on the object
+// holding the param or field.
+func (c *Condition) cel(value interface{}) string {
+	var terms []string
+	sel := "self"
+	for _, seg := range c.Path {
+		terms = append(terms, "has("+sel+"."+celField(seg)+")")
+		sel += "." + celField(seg)
+	}
+	lit := ""
+	switch v := value.(type) {
+	case string:
+		lit = strconv.Quote(v)
+	case float64:
+		lit = strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(lit, ".eE") {
+			lit += ".0"
+		}
+	default:
+		lit = fmt.Sprint(v)
+	}
+	return strings.Join(append(terms, sel+" == "+lit), " && ")
+}
+
+// ifSchema returns the JSON Schema that an object matches when the
+// condition holds.
+func (c *Condition) ifSchema(value interface{}) jsonObject {
+	s := jsonObject{{Key: "const", Value: value}}
+	for i := len(c.Path) - 1; i >= 0; i-- {
+		s = jsonObject{
+			{Key: "properties", Value: jsonObject{{Key: c.Path[i], Value: s}}},
+			{Key: "required", Value: []string{c.Path[i]}},
+		}
+	}
+	return s
+}
+
+// celField escapes a property name the way the API server exposes it to CEL.
+func celField(name string) string {
+	switch name {
+	case "true", "false", "null", "in", "as", "break", "const", "continue", "else",
+		"for", "function", "if", "import", "let", "loop", "package", "namespace",
+		"return", "var", "void", "while":
+		return "__" + name + "__"
+	}
+	r := strings.NewReplacer("__", "__underscores__", ".", "__dot__", "-", "__dash__", "/", "__slash__")
+	return r.Replace(name)
+}
+
+// nonEmpty returns the JSON Schema keyword that keeps a value of the type of
+// n from being empty, for types where empty counts as unset.
+func nonEmpty(n *Node) string {
+	te := strings.TrimPrefix(underlyingOf(n), "*")
+	switch {
+	case strings.HasPrefix(te, "[]"):
+		return "minItems"
+	case strings.HasPrefix(te, "map["):
+		return "minProperties"
+	case te == "string":
+		return "minLength"
+	}
+	return ""
+}
+
+// conditionRules returns the CEL rules of the object n that require its
+// params or fields marked with @requiredIf. params selects the top-level
+// params of the root.
+func conditionRules(n *Node, params bool) []Validation {
+	var out []Validation
+	for _, k := range sortedKeys(n.Child) {
+		c := n.Child[k]
+		if c.RequiredIf == nil || (params && !c.IsParam) || inherited(n, c) {
+			continue // the rules of base types come with their schema
+		}
+		v, err := c.RequiredIf.resolve(n)
+		if err != nil {
+			continue // reported by Check
+		}
+		sel := "self." + celField(c.Name)
+		then := "has(" + sel + ")"
+		if nonEmpty(c) != "" {
+			then = "(" + then + " && " + sel + ".size() > 0)"
+		}
+		out = append(out, Validation{
+			Rule:    "!(" + c.RequiredIf.cel(v) + ") || " + then,
+			Message: requiredIfMessage(c),
+		})
+	}
+	return out
+}
+
+// requiredIfMessage returns the message of the @requiredIf rule of n.
+func requiredIfMessage(n *Node) string {
+	return fmt.Sprintf("%s is required when %s is %s", n.Name, strings.Join(n.RequiredIf.Path, "."), n.RequiredIf.Value)
+}
+
+// conditionSchemas returns the JSON Schema if/then pairs of the @requiredIf
+// params or fields of the object n, for its "allOf".
+func conditionSchemas(n *Node, params bool) []interface{} {
+	var out []interface{}
+	for _, k := range sortedKeys(n.Child) {
+		c := n.Child[k]
+		if c.RequiredIf == nil || (params && !c.IsParam) {
+			continue
+		}
+		v, err := c.RequiredIf.resolve(n)
+		if err != nil {
+			continue
+		}
+		then := jsonObject{{Key: "required", Value: []string{c.Name}}}
+		if kw := nonEmpty(c); kw != "" {
+			then = append(jsonObject{{Key: "properties", Value: jsonObject{
+				{Key: c.Name, Value: jsonObject{{Key: kw, Value: 1}}},
+			}}}, then...)
+		}
+		out = append(out, jsonObject{{Key: "if", Value: c.RequiredIf.ifSchema(v)}, {Key: "then", Value: then}})
+	}
+	return out
+}
+
+// conditions reports @requiredIf and @visibleIf conditions that do not name
+// a scalar param or field next to n, or whose value does not fit it.
+func (c *checker) conditions(n *Node) {
+	for _, cond := range []*Condition{n.RequiredIf, n.VisibleIf} {
+		if cond == nil {
+			continue
+		}
+		if _, err := cond.resolve(n.Parent); err != nil {
+			c.errorf(cond.Pos, "%s: invalid condition %s: %v", n.Name, cond, err)
+		}
+	}
+}
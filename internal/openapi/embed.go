@@ -0,0 +1,160 @@
+package openapi
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  @extends and @embed typedefs                                               */
+/* -------------------------------------------------------------------------- */
+
+// Embed is an @extends or @embed of a typedef: the struct typedef Type whose
+// fields it inherits. The generated Go struct embeds Type inline.
+type Embed struct {
+	Type string
+	Pos  diag.Pos // Location of the type name
+}
+
+// embed adds e to the base types of the typedef r.
+func (r *Raw) embed(e Embed) error {
+	for _, o := range r.Embeds {
+		if o.Type == e.Type {
+			return diag.Errorf(e.Pos, "duplicate @extends %s for %q", e.Type, r.Path[0])
+		}
+	}
+	r.Embeds = append(r.Embeds, e)
+	return nil
+}
+
+// embedded returns the struct typedef e names, or nil.
+func embedded(root *Node, e Embed) *Node {
+	b := root.Child[e.Type]
+	if b == nil || b.IsParam || len(b.Enums) > 0 || b.TypeExpr != "struct" {
+		return nil
+	}
+	return b
+}
+
+// inherited reports whether the child c of n comes from a base type of n.
+func inherited(n, c *Node) bool { return c.Parent != n }
+
+// inherit adds the fields of the base types of every typedef of root to its
+// children. They are the nodes of the base type, shared the way Go promotes
+// the fields of an embedded struct, so their Parent stays the base type, see
+// inherited. Fields declared by the typedef itself are kept and cycles are
+// cut short; embedErrors reports both.
+func inherit(root *Node) {
+	done := map[*Node]bool{}
+	visiting := map[*Node]bool{}
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		if done[n] || visiting[n] {
+			return
+		}
+		visiting[n] = true
+		for _, e := range n.Embeds {
+			b := embedded(root, e)
+			if b == nil {
+				continue
+			}
+			visit(b)
+			for _, k := range sortedKeys(b.Child) {
+				if _, ok := n.Child[k]; !ok {
+					n.Child[k] = b.Child[k]
+				}
+			}
+		}
+		delete(visiting, n)
+		done[n] = true
+	}
+	for _, k := range sortedKeys(root.Child) {
+		visit(root.Child[k])
+	}
+}
+
+// embedErrors reports base types that are not struct typedefs, cycles of
+// base types, and fields that a typedef both declares and inherits, or
+// inherits twice: encoding/json would silently drop or shadow them.
+func embedErrors(root *Node) []*diag.Error {
+	var errs []*diag.Error
+	errorf := func(pos diag.Pos, format string, args ...interface{}) {
+		errs = append(errs, diag.Errorf(pos, format, args...).(*diag.Error))
+	}
+
+	state := map[*Node]int{} // 1 while its base types are walked, 2 after
+	var path []string
+	cyclic := false
+	var visit func(n *Node)
+	visit = func(n *Node) {
+		state[n] = 1
+		path = append(path, n.Name)
+		for _, e := range n.Embeds {
+			b := root.Child[e.Type]
+			switch {
+			case b == nil || !b.Pos.IsValid():
+				errorf(e.Pos, "%s: undefined type %q", n.Name, e.Type)
+			case embedded(root, e) == nil:
+				errorf(e.Pos, "%s: %s is not a struct typedef and cannot be embedded", n.Name, e.Type)
+			case state[b] == 1:
+				i := len(path) - 1
+				for path[i] != b.Name {
+					i--
+				}
+				cyclic = true
+				cycle := append([]string{n.Name}, path[i:]...) // from n back to n
+				errorf(e.Pos, "%s: @extends cycle %s", n.Name, strings.Join(cycle, " → "))
+			case state[b] == 0:
+				visit(b)
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = 2
+	}
+	for _, k := range sortedKeys(root.Child) {
+		if n := root.Child[k]; state[n] == 0 && len(n.Embeds) > 0 {
+			visit(n)
+		}
+	}
+	if cyclic {
+		return errs // the inherited fields are incomplete
+	}
+
+	for _, k := range sortedKeys(root.Child) {
+		n := root.Child[k]
+		from := map[string]string{} // inherited field → its base type
+		for _, e := range n.Embeds {
+			b := embedded(root, e)
+			if b == nil {
+				continue
+			}
+			for _, f := range sortedKeys(b.Child) {
+				c := n.Child[f]
+				prev, twice := from[f]
+				switch {
+				case !inherited(n, c):
+					errorf(c.Pos.Find(c.Name), "%s: field %s is also inherited from %s", n.Name, f, e.Type)
+				case twice:
+					errorf(e.Pos, "%s: field %s is inherited from both %s and %s", n.Name, f, prev, e.Type)
+				default:
+					from[f] = e.Type
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// embedError returns the errors of embedErrors as one, in source order.
+func embedError(root *Node) error {
+	errs := embedErrors(root)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Pos.Line < errs[j].Pos.Line })
+	var all []error
+	for _, e := range errs {
+		all = append(all, e)
+	}
+	return errors.Join(all...)
+}
@@ -0,0 +1,113 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  Ordered JSON objects                                                       */
+/* -------------------------------------------------------------------------- */
+
+// jsonObject is a JSON object that keeps the order of its members.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+func (o jsonObject) get(key string) (jsonObject, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			obj, ok := m.Value.(jsonObject)
+			return obj, ok
+		}
+	}
+	return nil, false
+}
+
+func (o jsonObject) set(key string, v interface{}) {
+	for i := range o {
+		if o[i].Key == key {
+			o[i].Value = v
+		}
+	}
+}
+
+// insertAfter inserts m after the member named key, or at the end. A member
+// o already has is kept: the hints of a field win over those of its alias.
+func (o jsonObject) insertAfter(key string, m jsonMember) jsonObject {
+	for i := range o {
+		if o[i].Key == m.Key {
+			return o
+		}
+	}
+	for i := range o {
+		if o[i].Key == key {
+			return append(o[:i+1], append(jsonObject{m}, o[i+1:]...)...)
+		}
+	}
+	return append(o, m)
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered reads the next JSON value from dec, decoding objects as
+// jsonObject.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := jsonObject{}
+		for dec.More() {
+			k, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, jsonMember{Key: k.(string), Value: v})
+		}
+		_, err = dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
@@ -3,6 +3,7 @@ package openapi
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/format"
 	"os"
@@ -12,7 +13,9 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
 	"github.com/cozystack/cozyvalues-gen/internal/patterns"
 	"go.etcd.io/etcd/version"
 	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -45,6 +48,7 @@ const (
 	aliasResources   = "resources"
 	aliasRequest     = "request"
 	aliasLimit       = "limit"
+	aliasIntOrString = "intOrString"
 )
 
 type Raw struct {
@@ -54,7 +58,18 @@ type Raw struct {
 	Enums       []string
 	DefaultVal  string
 	Description string
-	OmitEmpty   bool // Field marked with [name] for omitempty
+	Doc         string     // Long-form text from the "##" lines after the first paragraph
+	OmitEmpty   bool       // Field marked with [name] for omitempty
+	Required    bool       // Marked with @required
+	Immutable   bool       // Marked with @immutable
+	RequiredIf  *Condition // @requiredIf condition
+	VisibleIf   *Condition // @visibleIf condition
+	Pos         diag.Pos   // Location of the annotation tag
+	Section     string     // README @section a param is declared under
+
+	Discriminator string    // Field of a @union that selects the variant
+	Variants      []Variant // @variant members of a @union
+	Embeds        []Embed   // @extends and @embed base types of a typedef
 
 	// Validation constraints
 	Minimum          *float64
@@ -66,15 +81,65 @@ type Raw struct {
 	Pattern          string
 	MinItems         *int64
 	MaxItems         *int64
+	ListType         string   // @listType: set, map or atomic
+	ListMapKeys      []string // @listMapKey fields of a map list
+	MinProperties    *int64
+	MaxProperties    *int64
+	KeyPattern       string
+
+	Examples    []Example    // @example values, checked like values
+	Validations []Validation // @validate rules of a param, field or typedef
 }
 
+// Example is the source text of an @example value, either the rest of the
+// @example line or the YAML block on the "##" lines below it.
+type Example struct {
+	Value string
+	Pos   diag.Pos // Location of the first character of Value
+}
+
+// Validation is a @validate CEL rule. It becomes an x-kubernetes-validations
+// entry of the schema of its param, field or typedef.
+type Validation struct {
+	Rule    string
+	Message string
+	Pos     diag.Pos // Location of the first character of Rule
+}
+
+// IsParam reports whether r comes from a @param annotation.
+func (r Raw) IsParam() bool { return r.K == kParam }
+
+// IsField reports whether r comes from a @field/@property annotation. Fields
+// that appear before any @typedef have a single-element Path.
+func (r Raw) IsField() bool { return r.K == kField }
+
+// IsTypedef reports whether r comes from a @typedef annotation.
+func (r Raw) IsTypedef() bool { return r.K == kTypedef }
+
+// IsUnion reports whether r comes from a @union annotation, a typedef with
+// variants.
+func (r Raw) IsUnion() bool { return r.K == kTypedef && r.Discriminator != "" }
+
+// IsAlias reports whether r comes from a @typedef of a non-struct type, such
+// as {[]string}, which names the type for reuse.
+func (r Raw) IsAlias() bool { return r.K == kTypedef && r.TypeExpr != "struct" }
+
+// IsEnum reports whether r comes from an @enum annotation.
+func (r Raw) IsEnum() bool { return r.K == kEnum }
+
 // JSDoc-like syntax patterns (using shared patterns from internal/patterns)
 var (
-	reParam     = regexp.MustCompile(patterns.ParamPattern)
-	reField     = regexp.MustCompile(patterns.FieldPattern)
-	reTypedef   = regexp.MustCompile(patterns.TypedefPattern)
-	reEnum      = regexp.MustCompile(patterns.EnumPattern)
-	reEnumValue = regexp.MustCompile(patterns.EnumValuePattern)
+	reParam         = regexp.MustCompile(patterns.ParamPattern)
+	reField         = regexp.MustCompile(patterns.FieldPattern)
+	reTypedef       = regexp.MustCompile(patterns.TypedefPattern)
+	reUnion         = regexp.MustCompile(patterns.UnionPattern)
+	reVariant       = regexp.MustCompile(patterns.VariantPattern)
+	reExtends       = regexp.MustCompile(patterns.ExtendsPattern)
+	reEmbed         = regexp.MustCompile(patterns.EmbedPattern)
+	reDiscriminator = regexp.MustCompile(patterns.DiscriminatorPattern)
+	reEnum          = regexp.MustCompile(patterns.EnumPattern)
+	reEnumValue     = regexp.MustCompile(patterns.EnumValuePattern)
+	reUnionBar      = regexp.MustCompile(`\s*\|\s*`) // int | string → int|string
 
 	// Validation constraint patterns
 	reMinimum          = regexp.MustCompile(patterns.MinimumPattern)
@@ -86,6 +151,21 @@ var (
 	rePattern          = regexp.MustCompile(patterns.RegexPatternPattern)
 	reMinItems         = regexp.MustCompile(patterns.MinItemsPattern)
 	reMaxItems         = regexp.MustCompile(patterns.MaxItemsPattern)
+	reListType         = regexp.MustCompile(patterns.ListTypePattern)
+	reListMapKey       = regexp.MustCompile(patterns.ListMapKeyPattern)
+	reUniqueItems      = regexp.MustCompile(patterns.UniqueItemsPattern)
+	reMinProperties    = regexp.MustCompile(patterns.MinPropertiesPattern)
+	reMaxProperties    = regexp.MustCompile(patterns.MaxPropertiesPattern)
+	reKeyPattern       = regexp.MustCompile(patterns.KeyPatternPattern)
+	reExample          = regexp.MustCompile(patterns.ExamplePattern)
+	reRequired         = regexp.MustCompile(patterns.RequiredPattern)
+	reImmutable        = regexp.MustCompile(patterns.ImmutablePattern)
+	reRequiredIf       = regexp.MustCompile(patterns.RequiredIfPattern)
+	reVisibleIf        = regexp.MustCompile(patterns.VisibleIfPattern)
+	reValidate         = regexp.MustCompile(patterns.ValidatePattern)
+
+	reSection = regexp.MustCompile(patterns.SectionPattern)
+	reTag     = regexp.MustCompile(patterns.TagPattern)
 )
 
 // additional string-format aliases
@@ -115,7 +195,8 @@ var stringFormats = []string{
 	"date",
 }
 
-func isStringFormat(s string) bool {
+// IsStringFormat reports whether s is one of the string-format aliases.
+func IsStringFormat(s string) bool {
 	for _, f := range stringFormats {
 		if s == f {
 			return true
@@ -124,17 +205,135 @@ func isStringFormat(s string) bool {
 	return false
 }
 
+// ParseOptions tunes Parse.
+type ParseOptions struct {
+	// AllowTags lists extra @tags owned by other tools; lines using them are
+	// ignored instead of being reported as unknown.
+	AllowTags []string
+	// TypeAliases maps custom type names to the type expressions they stand
+	// for, e.g. Port → int. They are expanded in @param and @field types.
+	TypeAliases map[string]string
+	// OptionalByDefault makes every @param and @field without @required
+	// optional, as if declared as [name].
+	OptionalByDefault bool
+}
+
+// ExpandTypeAlias replaces the base type of expr when it names an alias,
+// keeping pointer, slice and map wrappers: with Port → int, "[]*Port"
+// becomes "[]*int". Aliases are not expanded recursively.
+func ExpandTypeAlias(expr string, aliases map[string]string) string {
+	if len(aliases) == 0 {
+		return expr
+	}
+	t := strings.TrimSpace(expr)
+	var prefix string
+	for {
+		switch {
+		case strings.HasPrefix(t, "*"), strings.HasPrefix(t, "?"):
+			prefix, t = prefix+t[:1], t[1:]
+			continue
+		case strings.HasPrefix(t, "[]"):
+			prefix, t = prefix+"[]", t[2:]
+			continue
+		case strings.HasPrefix(t, "map[") && strings.Contains(t, "]"):
+			i := strings.Index(t, "]") + 1
+			prefix, t = prefix+t[:i], t[i:]
+			continue
+		}
+		break
+	}
+	if a, ok := aliases[t]; ok {
+		return prefix + a
+	}
+	return expr
+}
+
+// Parse reads the annotations of a values file. Unknown or malformed @tags are
+// reported as errors.
 func Parse(file string) ([]Raw, error) {
+	return ParseWithOptions(file, ParseOptions{})
+}
+
+// ParseWithOptions is Parse with options.
+func ParseWithOptions(file string, opts ParseOptions) ([]Raw, error) {
 	data, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	lines := strings.Split(string(data), "\n")
+	return ParseBytes(file, data, opts)
+}
+
+// ParseBytes parses the annotations in data; file is only used in positions.
+func ParseBytes(file string, data []byte, opts ParseOptions) ([]Raw, error) {
+	rawLines := strings.Split(string(data), "\n")
 
 	var out []Raw
 	var currentEnum *Raw
 	var enumValues []string
 	var lastAnnotated *Raw // Track last @param or @field to accumulate constraints
+	typedef := -1          // Index in out of a @typedef not yet followed by a @field
+	union := -1            // Index in out of the @union that takes @variant lines
+	owner := -1            // Index in out of the @typedef that takes @embed lines
+	var section string     // Current README @section
+
+	// "##" lines right after an annotation continue its description until a
+	// blank "##" line; everything after that, including indented and fenced
+	// blocks, is kept verbatim as its Doc.
+	var docTarget *Raw
+	var docBreak, docBlank bool
+	addDoc := func(text string) {
+		text = strings.TrimRight(text, " \t")
+		switch {
+		case text == "":
+			docBreak = true
+			docBlank = docTarget.Doc != ""
+		case !docBreak && !isBlockLine(text):
+			if docTarget.Description != "" {
+				docTarget.Description += " "
+			}
+			docTarget.Description += strings.TrimSpace(text)
+		default:
+			docBreak = true
+			if docBlank {
+				docTarget.Doc += "\n"
+			}
+			if docTarget.Doc != "" {
+				docTarget.Doc += "\n"
+			}
+			docTarget.Doc += text
+			docBlank = false
+		}
+	}
+	setDocTarget := func(r *Raw) {
+		docTarget, docBreak, docBlank = r, false, false
+	}
+
+	// A bare "## @example" collects the "##" lines below it, up to a blank
+	// "##" line or the next annotation, as one YAML example.
+	var example *Example
+	finalizeExample := func() error {
+		if example == nil {
+			return nil
+		}
+		ex := *example
+		example = nil
+		if strings.TrimSpace(ex.Value) == "" {
+			return diag.Errorf(ex.Pos, "@example for %q has no value", strings.Join(lastAnnotated.Path, "."))
+		}
+		// Drop the indentation shared by all lines of the block
+		lines := strings.Split(ex.Value, "\n")
+		indent := len(lines[0])
+		for _, l := range lines {
+			indent = min(indent, len(l)-len(strings.TrimLeft(l, " ")))
+		}
+		for i := range lines {
+			lines[i] = lines[i][indent:]
+		}
+		ex.Value = strings.Join(lines, "\n")
+		ex.Pos.Col += indent
+		lastAnnotated.Examples = append(lastAnnotated.Examples, ex)
+		return nil
+	}
 
 	// finalizeLastAnnotated appends the last annotated item to output if it exists
 	finalizeLastAnnotated := func() {
@@ -144,8 +343,28 @@ func Parse(file string) ([]Raw, error) {
 		}
 	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+	for i, rawLine := range rawLines {
+		line := strings.TrimSpace(rawLine)
+		pos := diag.At(file, rawLines, i+1, strings.Index(rawLine, "@")+1)
+		if !strings.HasPrefix(line, "#") {
+			docTarget = nil
+		}
+
+		if example != nil {
+			text := strings.TrimPrefix(strings.TrimLeft(line, "#"), " ")
+			if strings.HasPrefix(line, "##") && strings.TrimSpace(text) != "" && !reTag.MatchString(line) {
+				if example.Value == "" {
+					example.Pos = diag.At(file, rawLines, i+1, len(rawLine)-len(strings.TrimLeft(rawLine, " \t"))+len(line)-len(text)+1)
+				} else {
+					example.Value += "\n"
+				}
+				example.Value += strings.TrimRight(text, " \t")
+				continue
+			}
+			if err := finalizeExample(); err != nil {
+				return nil, err
+			}
+		}
 
 		// Check for enum value
 		if m := reEnumValue.FindStringSubmatch(line); m != nil && currentEnum != nil {
@@ -169,16 +388,37 @@ func Parse(file string) ([]Raw, error) {
 			continue
 		}
 
+		// @validate also applies to a @typedef right above it
+		if m := reValidate.FindStringSubmatch(line); m != nil && (lastAnnotated != nil || typedef >= 0) {
+			v := Validation{Rule: strings.TrimSpace(m[1])}
+			if i := strings.LastIndex(v.Rule, " - "); i >= 0 {
+				v.Rule, v.Message = strings.TrimSpace(v.Rule[:i]), strings.TrimSpace(v.Rule[i+3:])
+			}
+			at := pos.Find("@validate")
+			at.Col += len("@validate")
+			v.Pos = at.Find(v.Rule)
+			if lastAnnotated != nil {
+				lastAnnotated.Validations = append(lastAnnotated.Validations, v)
+			} else {
+				out[typedef].Validations = append(out[typedef].Validations, v)
+			}
+			continue
+		}
+
 		// Check for validation constraints (apply to lastAnnotated @param or @field).
-		// Note: @section and other README-only annotations are not recognized here,
-		// so constraints continue to accumulate on the preceding @param/@field.
-		// This is intentional — @section is a README concept, not OpenAPI.
+		// Note: @section only names the README table of the following params and
+		// does not end the preceding @param/@field, so constraints after it
+		// continue to accumulate there.
 		if lastAnnotated != nil {
 			paramName := strings.Join(lastAnnotated.Path, ".")
+			if m := reTag.FindStringSubmatch(line); m != nil && lastAnnotated.K == kTypedef &&
+				contains([]string{"required", "immutable", "requiredIf", "visibleIf"}, m[1]) {
+				return nil, diag.Errorf(pos, "@%s applies to params and fields, not to the @typedef %s", m[1], paramName)
+			}
 			if m := reMinimum.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseFloat(m[1], 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @minimum value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @minimum value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.Minimum = &val
 				continue
@@ -186,11 +426,36 @@ func Parse(file string) ([]Raw, error) {
 			if m := reMaximum.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseFloat(m[1], 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @maximum value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @maximum value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.Maximum = &val
 				continue
 			}
+			if reRequired.MatchString(line) {
+				if lastAnnotated.OmitEmpty {
+					return nil, diag.Errorf(pos, "%q is declared optional with [%s] and cannot be @required", paramName, paramName)
+				}
+				lastAnnotated.Required = true
+				continue
+			}
+			if reImmutable.MatchString(line) {
+				lastAnnotated.Immutable = true
+				continue
+			}
+			if m := reRequiredIf.FindStringSubmatch(line); m != nil {
+				if lastAnnotated.RequiredIf != nil {
+					return nil, diag.Errorf(pos, "duplicate @requiredIf for %q", paramName)
+				}
+				lastAnnotated.RequiredIf = newCondition(m[1], m[2], pos)
+				continue
+			}
+			if m := reVisibleIf.FindStringSubmatch(line); m != nil {
+				if lastAnnotated.VisibleIf != nil {
+					return nil, diag.Errorf(pos, "duplicate @visibleIf for %q", paramName)
+				}
+				lastAnnotated.VisibleIf = newCondition(m[1], m[2], pos)
+				continue
+			}
 			if reExclusiveMinimum.MatchString(line) {
 				lastAnnotated.ExclusiveMinimum = true
 				continue
@@ -202,7 +467,7 @@ func Parse(file string) ([]Raw, error) {
 			if m := reMinLength.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseInt(m[1], 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @minLength value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @minLength value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.MinLength = &val
 				continue
@@ -210,7 +475,7 @@ func Parse(file string) ([]Raw, error) {
 			if m := reMaxLength.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseInt(m[1], 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @maxLength value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @maxLength value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.MaxLength = &val
 				continue
@@ -222,7 +487,7 @@ func Parse(file string) ([]Raw, error) {
 			if m := reMinItems.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseInt(m[1], 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @minItems value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @minItems value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.MinItems = &val
 				continue
@@ -230,17 +495,69 @@ func Parse(file string) ([]Raw, error) {
 			if m := reMaxItems.FindStringSubmatch(line); m != nil {
 				val, err := strconv.ParseInt(m[1], 10, 64)
 				if err != nil {
-					return nil, fmt.Errorf("invalid @maxItems value %q for %q: %w", m[1], paramName, err)
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @maxItems value %q for %q: %v", m[1], paramName, err)
 				}
 				lastAnnotated.MaxItems = &val
 				continue
 			}
+			if m := reListType.FindStringSubmatch(line); m != nil {
+				if !contains([]string{"set", "map", "atomic"}, m[1]) {
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @listType %q for %q (want set, map or atomic)", m[1], paramName)
+				}
+				if lastAnnotated.ListType != "" && lastAnnotated.ListType != m[1] {
+					return nil, diag.Errorf(pos, "@listType %s conflicts with @listType %s for %q", m[1], lastAnnotated.ListType, paramName)
+				}
+				lastAnnotated.ListType = m[1]
+				continue
+			}
+			if reUniqueItems.MatchString(line) {
+				if lastAnnotated.ListType != "" && lastAnnotated.ListType != "set" {
+					return nil, diag.Errorf(pos, "@uniqueItems conflicts with @listType %s for %q", lastAnnotated.ListType, paramName)
+				}
+				lastAnnotated.ListType = "set"
+				continue
+			}
+			if m := reListMapKey.FindStringSubmatch(line); m != nil {
+				lastAnnotated.ListMapKeys = append(lastAnnotated.ListMapKeys, m[1])
+				continue
+			}
+			if m := reMinProperties.FindStringSubmatch(line); m != nil {
+				val, err := strconv.ParseInt(m[1], 10, 64)
+				if err != nil {
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @minProperties value %q for %q: %v", m[1], paramName, err)
+				}
+				lastAnnotated.MinProperties = &val
+				continue
+			}
+			if m := reMaxProperties.FindStringSubmatch(line); m != nil {
+				val, err := strconv.ParseInt(m[1], 10, 64)
+				if err != nil {
+					return nil, diag.Errorf(pos.Find(m[1]), "invalid @maxProperties value %q for %q: %v", m[1], paramName, err)
+				}
+				lastAnnotated.MaxProperties = &val
+				continue
+			}
+			if m := reKeyPattern.FindStringSubmatch(line); m != nil {
+				lastAnnotated.KeyPattern = strings.TrimSpace(m[1])
+				continue
+			}
+			if m := reExample.FindStringSubmatch(line); m != nil {
+				if v := strings.TrimSpace(m[1]); v != "" {
+					at := pos.Find("@example")
+					at.Col += len("@example")
+					lastAnnotated.Examples = append(lastAnnotated.Examples, Example{Value: v, Pos: at.Find(v)})
+				} else {
+					example = &Example{Pos: pos}
+				}
+				continue
+			}
 		}
 
 		// Check for @param
 		if m := reParam.FindStringSubmatch(line); m != nil {
 			// Finalize previous param and enum
 			finalizeLastAnnotated()
+			typedef, union, owner = -1, -1, -1
 			if currentEnum != nil {
 				currentEnum.Enums = enumValues
 				out = append(out, *currentEnum)
@@ -248,7 +565,7 @@ func Parse(file string) ([]Raw, error) {
 				enumValues = nil
 			}
 
-			typeExpr := strings.TrimSpace(m[1])
+			typeExpr := ExpandTypeAlias(reUnionBar.ReplaceAllString(strings.TrimSpace(m[1]), "|"), opts.TypeAliases)
 			nameRaw := m[2]
 			name := strings.Trim(nameRaw, "[]")
 			omitEmpty := strings.HasPrefix(nameRaw, "[") && strings.HasSuffix(nameRaw, "]")
@@ -263,18 +580,26 @@ func Parse(file string) ([]Raw, error) {
 
 			r := Raw{
 				K:           kParam,
-				Path:        []string{name},
+				Path:        splitKeyPath(name),
 				TypeExpr:    typeExpr,
 				DefaultVal:  defaultVal,
 				Description: desc,
 				OmitEmpty:   omitEmpty,
+				Pos:         pos,
+				Section:     section,
 			}
 			lastAnnotated = &r // Don't append yet, wait for constraints
+			setDocTarget(lastAnnotated)
 			continue
 		}
 
-		// Check for @typedef
-		if m := reTypedef.FindStringSubmatch(line); m != nil {
+		// Check for @typedef and @union
+		m := reTypedef.FindStringSubmatch(line)
+		isUnion := m == nil && reUnion.MatchString(line)
+		if isUnion {
+			m = reUnion.FindStringSubmatch(line)
+		}
+		if m != nil {
 			// Finalize previous param and enum
 			finalizeLastAnnotated()
 			if currentEnum != nil {
@@ -284,19 +609,91 @@ func Parse(file string) ([]Raw, error) {
 				enumValues = nil
 			}
 
-			typeName := m[1]
-			desc := ""
-			if len(m) > 2 {
-				desc = m[2]
+			typeExpr, typeName, desc := "struct", m[1], m[2]
+			if !isUnion {
+				typeName, desc = m[2], m[3]
+				if m[4] != "" {
+					desc = m[4] // @extends right after the name
+				}
+				if t := strings.TrimSpace(m[1]); t != "struct" && t != "object" {
+					typeExpr = ExpandTypeAlias(reUnionBar.ReplaceAllString(t, "|"), opts.TypeAliases)
+				}
 			}
 
 			r := Raw{
 				K:           kTypedef,
 				Path:        []string{typeName},
-				TypeExpr:    "struct",
+				TypeExpr:    typeExpr,
 				Description: desc,
+				Pos:         pos,
+			}
+			if typeExpr != "struct" {
+				// An alias takes constraints like a @param
+				if strings.HasPrefix(typeExpr, "*") {
+					return nil, diag.Errorf(pos.Find("{"), "@typedef %s cannot be a pointer, use {*%s} where it is referenced", typeName, typeName)
+				}
+				if reExtends.MatchString(desc) {
+					return nil, diag.Errorf(pos.Find("@extends"), "@typedef %s is not a struct and cannot @extends", typeName)
+				}
+				typedef, union, owner = -1, -1, -1
+				lastAnnotated = &r
+				setDocTarget(lastAnnotated)
+				continue
+			}
+			if e := reExtends.FindStringSubmatchIndex(desc); e != nil {
+				r.Description = desc[:e[0]]
+				at := pos.Find("@extends")
+				for _, name := range strings.Split(desc[e[2]:e[3]], ",") {
+					name = strings.TrimSpace(name)
+					at = at.Find(name)
+					if err := r.embed(Embed{Type: name, Pos: at}); err != nil {
+						return nil, err
+					}
+					at.Col += len(name)
+				}
+			}
+			union = -1
+			if isUnion {
+				r.Discriminator = "type"
+				if d := reDiscriminator.FindStringSubmatchIndex(desc); d != nil {
+					r.Discriminator = desc[d[2]:d[3]]
+					r.Description = desc[:d[0]]
+				}
+				union = len(out)
 			}
 			out = append(out, r)
+			typedef = len(out) - 1
+			owner = typedef
+			setDocTarget(&out[len(out)-1])
+			continue
+		}
+
+		if m := reEmbed.FindStringSubmatch(line); m != nil {
+			finalizeLastAnnotated()
+			if owner < 0 {
+				return nil, diag.Errorf(pos, "@embed must follow a @typedef")
+			}
+			if err := out[owner].embed(Embed{Type: m[1], Pos: pos.Find("{").Find(m[1])}); err != nil {
+				return nil, err
+			}
+			docTarget = nil
+			continue
+		}
+
+		if m := reVariant.FindStringSubmatch(line); m != nil {
+			if union < 0 {
+				return nil, diag.Errorf(pos, "@variant must follow a @union")
+			}
+			u := &out[union]
+			v := Variant{Value: strings.Trim(m[1], `"`), Type: m[2], Description: m[3], Pos: pos}
+			switch {
+			case v.Value == u.Discriminator:
+				return nil, diag.Errorf(pos.Find(m[1]), "@variant %s of %q has the name of its discriminator", v.Value, u.Path[0])
+			case u.variant(v.Value) != nil:
+				return nil, diag.Errorf(pos.Find(m[1]), "duplicate @variant %s for %q", v.Value, u.Path[0])
+			}
+			u.Variants = append(u.Variants, v)
+			docTarget = nil
 			continue
 		}
 
@@ -304,6 +701,7 @@ func Parse(file string) ([]Raw, error) {
 		if m := reEnum.FindStringSubmatch(line); m != nil {
 			// Finalize previous param and enum
 			finalizeLastAnnotated()
+			typedef, union, owner = -1, -1, -1
 			if currentEnum != nil {
 				currentEnum.Enums = enumValues
 				out = append(out, *currentEnum)
@@ -322,8 +720,10 @@ func Parse(file string) ([]Raw, error) {
 				Path:        []string{enumName},
 				TypeExpr:    baseType,
 				Description: desc,
+				Pos:         pos,
 			}
 			enumValues = []string{}
+			setDocTarget(currentEnum)
 			continue
 		}
 
@@ -331,6 +731,7 @@ func Parse(file string) ([]Raw, error) {
 		if m := reField.FindStringSubmatch(line); m != nil {
 			// Finalize previous param and enum
 			finalizeLastAnnotated()
+			typedef = -1
 			if currentEnum != nil {
 				currentEnum.Enums = enumValues
 				out = append(out, *currentEnum)
@@ -338,9 +739,10 @@ func Parse(file string) ([]Raw, error) {
 				enumValues = nil
 			}
 
-			typeExpr := strings.TrimSpace(m[1])
+			typeExpr := ExpandTypeAlias(reUnionBar.ReplaceAllString(strings.TrimSpace(m[1]), "|"), opts.TypeAliases)
 			fieldNameRaw := m[2]
-			fieldName := strings.Trim(fieldNameRaw, "[]")
+			keys := splitKeyPath(strings.Trim(fieldNameRaw, "[]"))
+			fieldName := strings.Join(keys, ".")
 			omitEmpty := strings.HasPrefix(fieldNameRaw, "[") && strings.HasSuffix(fieldNameRaw, "]")
 			defaultVal := ""
 			if len(m) > 3 && m[3] != "" {
@@ -355,36 +757,223 @@ func Parse(file string) ([]Raw, error) {
 			var parentType string
 			for i := len(out) - 1; i >= 0; i-- {
 				if out[i].K == kTypedef {
+					if out[i].TypeExpr != "struct" {
+						return nil, diag.Errorf(pos, "@field %s cannot belong to the @typedef %s, which is not a struct", fieldName, out[i].Path[0])
+					}
 					parentType = out[i].Path[0]
 					break
 				}
 			}
 
+			// A field without a parent typedef keeps a single-element path;
+			// Build ignores it and lint reports it.
+			path := []string{fieldName}
 			if parentType != "" {
-				r := Raw{
-					K:           kField,
-					Path:        []string{parentType, fieldName},
-					TypeExpr:    typeExpr,
-					DefaultVal:  defaultVal,
-					Description: desc,
-					OmitEmpty:   omitEmpty,
-				}
-				lastAnnotated = &r // Don't append yet, wait for constraints
+				path = append([]string{parentType}, keys...)
+			}
+			r := Raw{
+				K:           kField,
+				Path:        path,
+				TypeExpr:    typeExpr,
+				DefaultVal:  defaultVal,
+				Description: desc,
+				OmitEmpty:   omitEmpty,
+				Pos:         pos,
 			}
+			lastAnnotated = &r // Don't append yet, wait for constraints
+			setDocTarget(lastAnnotated)
+			continue
+		}
+
+		if m := reSection.FindStringSubmatch(line); m != nil {
+			section = strings.TrimSpace(m[1])
+			docTarget = nil
 			continue
 		}
+
+		// Anything else that looks like an annotation must be known
+		if m := reTag.FindStringSubmatch(line); m != nil {
+			if err := checkTag(m[1], pos, currentEnum != nil, lastAnnotated != nil, opts.AllowTags); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if docTarget != nil && strings.HasPrefix(line, "##") {
+			addDoc(strings.TrimPrefix(strings.TrimLeft(line, "#"), " "))
+		}
 	}
 
-	// Finalize any pending param and enum
+	// Finalize any pending example, param and enum
+	if err := finalizeExample(); err != nil {
+		return nil, err
+	}
 	finalizeLastAnnotated()
 	if currentEnum != nil {
 		currentEnum.Enums = enumValues
 		out = append(out, *currentEnum)
 	}
 
+	if opts.OptionalByDefault {
+		for i := range out {
+			if (out[i].K == kParam || out[i].K == kField) && !out[i].Required {
+				out[i].OmitEmpty = true
+			}
+		}
+	}
+
+	if err := checkDottedParams(out); err != nil {
+		return nil, err
+	}
 	return out, nil
 }
 
+// checkDottedParams reports dotted @param and @field paths that go through a
+// param or field whose declared type has no fields, e.g. "a.b" when a is
+// {string}, or that disagree with it on being a list ("a[].b" needs a to be a
+// list). The path of a field starts with its @typedef.
+func checkDottedParams(rows []Raw) error {
+	type key struct {
+		k    kind
+		path string
+	}
+	declared := map[key]Raw{}
+	enums := map[string]bool{}
+	for _, r := range rows {
+		switch r.K {
+		case kParam, kField:
+			declared[key{r.K, strings.Join(r.Path, ".")}] = r
+		case kEnum:
+			enums[r.Path[0]] = true
+		}
+	}
+	for _, r := range rows {
+		first := 1 // index of the first key below a param or field
+		if r.K == kField {
+			first = 2
+		}
+		if (r.K != kParam && r.K != kField) || len(r.Path) <= first {
+			continue
+		}
+		at := r.Pos.Find("}").Find(strings.Join(r.Path[first-1:], "."))
+		for i := first; i < len(r.Path); i++ {
+			parent := strings.TrimSuffix(strings.Join(r.Path[:i], "."), "[]")
+			d, ok := declared[key{r.K, parent}]
+			if !ok {
+				continue
+			}
+			te := strings.TrimPrefix(strings.TrimSpace(d.TypeExpr), "*")
+			if strings.HasSuffix(r.Path[i-1], "[]") {
+				if !strings.HasPrefix(te, "[]") {
+					return diag.Errorf(at, "%s is declared as {%s} at %s, not a list", parent, d.TypeExpr, d.Pos)
+				}
+				te = strings.TrimPrefix(strings.TrimSpace(te[2:]), "*")
+			}
+			if isPrimitive(te) || enums[te] || te == aliasEmptyObject ||
+				strings.HasPrefix(te, "[]") || strings.HasPrefix(te, "map[") {
+				return diag.Errorf(at, "%s is declared as {%s} at %s, which has no fields", parent, d.TypeExpr, d.Pos)
+			}
+		}
+	}
+	return nil
+}
+
+// splitKeyPath splits a @param name into its keys at the dots outside
+// double quotes and unquotes them: ingress."cert-manager".enabled becomes
+// ingress, cert-manager, enabled. A "[]" suffix marking list items is kept.
+func splitKeyPath(name string) []string {
+	var out []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range name {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			out = append(out, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(out, cur.String())
+}
+
+// isBlockLine reports whether a documentation line starts an indented or
+// fenced block, which is never folded into the description.
+func isBlockLine(text string) bool {
+	return strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") ||
+		strings.HasPrefix(text, "```") || strings.HasPrefix(text, "~~~")
+}
+
+// checkTag explains why an @tag line was not consumed by Parse. README-only
+// tags and allow-listed tags are accepted.
+func checkTag(tag string, pos diag.Pos, inEnum, annotated bool, allow []string) error {
+	for _, t := range allow {
+		if strings.TrimPrefix(t, "@") == tag {
+			return nil
+		}
+	}
+	switch {
+	case tag == "section":
+		return nil
+	case tag == "value" && !inEnum:
+		return diag.Errorf(pos, "@value must follow an @enum")
+	case tag == "validate" && !annotated:
+		return diag.Errorf(pos, "@validate must follow a @param, @field or @typedef")
+	case contains(patterns.ConstraintTags, tag) && !annotated:
+		return diag.Errorf(pos, "@%s must follow a @param or @field", tag)
+	case contains(patterns.Tags, tag):
+		return diag.Errorf(pos, "malformed @%s annotation", tag)
+	}
+	if s := closestTag(tag); s != "" {
+		return diag.Errorf(pos, "unknown annotation @%s (did you mean @%s?)", tag, s)
+	}
+	return diag.Errorf(pos, "unknown annotation @%s (use --allow-tag to accept tags owned by other tools)", tag)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// closestTag returns the known tag nearest to tag by edit distance, or ""
+// when nothing is close enough to be a plausible typo.
+func closestTag(tag string) string {
+	best, bestDist := "", len(tag)/3+2
+	for _, t := range patterns.Tags {
+		if d := editDistance(strings.ToLower(tag), strings.ToLower(t)); d < bestDist {
+			best, bestDist = t, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
 /* -------------------------------------------------------------------------- */
 /*  In-memory tree with implicit types                                         */
 /* -------------------------------------------------------------------------- */
@@ -397,10 +986,19 @@ type Node struct {
 	DefaultVal    string
 	HasDefaultVal bool // Set to true when DefaultVal is populated from YAML (even if empty)
 	Comment       string
+	Doc           string // long-form documentation, see Raw.Doc
 	OmitEmpty     bool
+	Required      bool // marked with @required, see IsRequired
+	Immutable     bool // marked with @immutable
+	RequiredIf    *Condition
+	VisibleIf     *Condition
+	Implicit      bool   // synthesized for the parents of a dotted @param path
+	DefaultInline bool   // DefaultVal comes from the annotation, not from YAML
+	Section       string // README @section of a param
 	Parent        *Node
 	Child         map[string]*Node
 	Order         int
+	Pos           diag.Pos // Location of the defining annotation
 
 	// Validation constraints
 	Minimum          *float64
@@ -412,6 +1010,71 @@ type Node struct {
 	Pattern          string
 	MinItems         *int64
 	MaxItems         *int64
+	ListType         string
+	ListMapKeys      []string
+	MinProperties    *int64
+	MaxProperties    *int64
+	KeyPattern       string
+
+	Examples    []Example
+	Validations []Validation
+
+	Discriminator string    // Field of a @union that selects the variant
+	Variants      []Variant // @variant members of a @union, see addVariants
+	Embeds        []Embed   // @extends and @embed base types, see inherit
+}
+
+// Documentation returns the description of n followed, after a blank line,
+// by its long-form documentation.
+func (n *Node) Documentation() string {
+	switch {
+	case n.Doc == "":
+		return n.Comment
+	case n.Comment == "":
+		return n.Doc
+	}
+	return n.Comment + "\n\n" + n.Doc
+}
+
+// IsRequired reports whether a param or field must be set in the values:
+// it is marked with @required, or it is neither optional ([name]) nor a
+// pointer, list or map, or an alias of one.
+func (n *Node) IsRequired() bool {
+	te := underlyingOf(n)
+	return n.Required || !(n.OmitEmpty || strings.HasPrefix(te, "*") ||
+		strings.HasPrefix(te, "[]") || strings.HasPrefix(te, "map["))
+}
+
+// ExampleValues returns the @example values of n as written.
+func (n *Node) ExampleValues() []string {
+	var out []string
+	for _, ex := range n.Examples {
+		out = append(out, ex.Value)
+	}
+	return out
+}
+
+// ByLine returns the declared children of n in source order. Types that
+// are only referenced have no position and are left out.
+func (n *Node) ByLine() []*Node {
+	var out []*Node
+	for _, c := range n.Child {
+		if c.Pos.IsValid() {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Pos.Line != out[j].Pos.Line {
+			return out[i].Pos.Line < out[j].Pos.Line
+		}
+		return out[i].Name < out[j].Name // a @union and its discriminator enum
+	})
+	return out
+}
+
+// ChildNames returns the names of the children of n, sorted.
+func (n *Node) ChildNames() []string {
+	return sortedKeys(n.Child)
 }
 
 func newNode(name string, p *Node) *Node {
@@ -427,7 +1090,7 @@ func ensure(root *Node, name string) *Node {
 	return n
 }
 
-// copyConstraints transfers validation constraints from Raw to Node.
+// copyConstraints transfers validation constraints and examples from Raw to Node.
 func copyConstraints(node *Node, raw *Raw) {
 	node.Minimum = raw.Minimum
 	node.Maximum = raw.Maximum
@@ -438,6 +1101,19 @@ func copyConstraints(node *Node, raw *Raw) {
 	node.Pattern = raw.Pattern
 	node.MinItems = raw.MinItems
 	node.MaxItems = raw.MaxItems
+	node.ListType = raw.ListType
+	node.ListMapKeys = raw.ListMapKeys
+	if node.ListType == "" && len(raw.ListMapKeys) > 0 {
+		node.ListType = "map" // implied by @listMapKey
+	}
+	node.MinProperties = raw.MinProperties
+	node.MaxProperties = raw.MaxProperties
+	node.KeyPattern = raw.KeyPattern
+	node.Immutable = raw.Immutable
+	node.RequiredIf = raw.RequiredIf
+	node.VisibleIf = raw.VisibleIf
+	node.Examples = raw.Examples
+	node.Validations = raw.Validations
 }
 
 func Build(rows []Raw) *Node {
@@ -445,18 +1121,65 @@ func Build(rows []Raw) *Node {
 	orderCounter := 0
 	isPrim := func(s string) bool { return isPrimitive(strings.TrimPrefix(s, "*")) }
 	addImplicit := func(name string) {
-		if name == "" || isPrim(name) || strings.HasPrefix(name, "[]") || strings.HasPrefix(name, "map[") {
+		if name == "" || name == "struct" || isPrim(name) || strings.HasPrefix(name, "[]") || strings.HasPrefix(name, "map[") {
 			return
 		}
 		ensure(root, name)
 	}
+	// addImplicitFor adds the types referenced by the type expression te
+	addImplicitFor := func(te string) {
+		te = strings.TrimSpace(te)
+		switch {
+		case strings.HasPrefix(te, "[]"):
+			base := strings.TrimPrefix(strings.TrimSpace(te[2:]), "*")
+			addImplicit(base)
+		case strings.HasPrefix(te, "map[") && strings.Contains(te, "]"):
+			idx := strings.Index(te, "]")
+			base := strings.TrimPrefix(strings.TrimSpace(te[idx+1:]), "*")
+			addImplicit(base)
+		default:
+			addImplicit(strings.TrimPrefix(te, "*"))
+		}
+	}
+
+	declareField := func(field *Node, r Raw) {
+		field.TypeExpr = r.TypeExpr
+		field.Comment = r.Description
+		field.Doc = r.Doc
+		field.Enums = r.Enums
+		field.OmitEmpty = r.OmitEmpty
+		field.Required = r.Required
+		field.Pos = r.Pos
+		if r.DefaultVal != "" {
+			field.DefaultVal = r.DefaultVal
+			field.HasDefaultVal = true
+			field.DefaultInline = true
+		}
+		copyConstraints(field, &r)
 
+		addImplicitFor(r.TypeExpr)
+	}
+
+	var dotted []Raw
 	for _, r := range rows {
 		if r.K == kTypedef {
 			// Create a node for the typedef
 			cur := ensure(root, r.Path[0])
 			cur.Comment = r.Description
-			cur.TypeExpr = "struct"
+			cur.Doc = r.Doc
+			cur.TypeExpr = r.TypeExpr
+			cur.Validations = r.Validations
+			if r.IsAlias() {
+				copyConstraints(cur, &r)
+				addImplicitFor(r.TypeExpr)
+			}
+			cur.Pos = r.Pos
+			cur.Discriminator = r.Discriminator
+			cur.Variants = r.Variants
+			cur.Embeds = r.Embeds
+			for _, v := range r.Variants {
+				addImplicit(v.Type)
+			}
 			continue
 		}
 
@@ -464,39 +1187,56 @@ func Build(rows []Raw) *Node {
 			// Create a node for the enum with enum values
 			cur := ensure(root, r.Path[0])
 			cur.Comment = r.Description
+			cur.Doc = r.Doc
 			cur.TypeExpr = r.TypeExpr
 			cur.Enums = r.Enums
+			cur.Pos = r.Pos
+			continue
+		}
+
+		if r.K == kField && len(r.Path) > 2 {
+			dotted = append(dotted, r) // a field of a nested object
+			continue
+		}
+
+		if r.K == kParam && len(r.Path) > 1 {
+			// Dotted paths are resolved once every explicit declaration is
+			// known; the top-level param keeps its place in the order.
+			if top := ensure(root, strings.TrimSuffix(r.Path[0], "[]")); !top.IsParam {
+				top.IsParam = true
+				top.Implicit = true
+				top.OmitEmpty = true
+				top.Order = orderCounter
+				orderCounter++
+				top.Pos = r.Pos
+				top.Section = r.Section
+			}
+			dotted = append(dotted, r)
 			continue
 		}
 
 		if r.K == kParam {
 			cur := ensure(root, r.Path[0])
 			cur.IsParam = true
+			cur.Implicit = false
 			cur.Order = orderCounter
 			orderCounter++
 			cur.TypeExpr = r.TypeExpr
 			cur.Comment = r.Description
+			cur.Doc = r.Doc
 			cur.Enums = r.Enums
 			cur.OmitEmpty = r.OmitEmpty
+			cur.Required = r.Required
+			cur.Pos = r.Pos
+			cur.Section = r.Section
 			if r.DefaultVal != "" {
 				cur.DefaultVal = r.DefaultVal
 				cur.HasDefaultVal = true
+				cur.DefaultInline = true
 			}
 			copyConstraints(cur, &r)
 
-			// Add implicit types
-			te := strings.TrimSpace(r.TypeExpr)
-			switch {
-			case strings.HasPrefix(te, "[]"):
-				base := strings.TrimPrefix(strings.TrimSpace(te[2:]), "*")
-				addImplicit(base)
-			case strings.HasPrefix(te, "map[") && strings.Contains(te, "]"):
-				idx := strings.Index(te, "]")
-				base := strings.TrimPrefix(strings.TrimSpace(te[idx+1:]), "*")
-				addImplicit(base)
-			default:
-				addImplicit(strings.TrimPrefix(te, "*"))
-			}
+			addImplicitFor(r.TypeExpr)
 			continue
 		}
 
@@ -509,32 +1249,86 @@ func Build(rows []Raw) *Node {
 			fieldName := r.Path[1]
 
 			parent := ensure(root, parentName)
-			field := ensure(parent, fieldName)
-			field.TypeExpr = r.TypeExpr
-			field.Comment = r.Description
-			field.Enums = r.Enums
-			field.OmitEmpty = r.OmitEmpty
-			if r.DefaultVal != "" {
-				field.DefaultVal = r.DefaultVal
-				field.HasDefaultVal = true
-			}
-			copyConstraints(field, &r)
+			declareField(ensure(parent, fieldName), r)
+		}
+	}
 
-			// Add implicit types
-			te := strings.TrimSpace(r.TypeExpr)
-			switch {
-			case strings.HasPrefix(te, "[]"):
-				base := strings.TrimPrefix(strings.TrimSpace(te[2:]), "*")
-				addImplicit(base)
-			case strings.HasPrefix(te, "map[") && strings.Contains(te, "]"):
-				idx := strings.Index(te, "]")
-				base := strings.TrimPrefix(strings.TrimSpace(te[idx+1:]), "*")
-				addImplicit(base)
-			default:
-				addImplicit(strings.TrimPrefix(te, "*"))
+	addVariants(root)
+
+	// A dotted param such as "postgres.persistence.size" or "backups[].name"
+	// becomes a field of the type of its parent path. Parents without a
+	// declared type, or declared {struct}, get a struct synthesized from the
+	// path, e.g. PostgresPersistence; declared typedefs are extended instead.
+	// Dotted fields work alike below their typedef: backup.schedule of the
+	// typedef Postgresql is a field of PostgresqlBackup.
+	sort.SliceStable(dotted, func(i, j int) bool { return len(dotted[i].Path) < len(dotted[j].Path) })
+	implicit := map[string]string{} // synthesized type → its path
+	objectOf := func(n *Node, path []string, pos diag.Pos) *Node {
+		list := strings.HasSuffix(path[len(path)-1], "[]")
+		if te := strings.TrimSpace(n.TypeExpr); te != "" && te != "struct" && te != "[]struct" {
+			return ensure(root, BaseType(Underlying(root, te)))
+		}
+		var name string
+		for _, seg := range path {
+			name += goName(strings.TrimSuffix(seg, "[]"))
+		}
+		if list {
+			name += "Item"
+		}
+		key := strings.Join(path, ".")
+		for root.Child[name] != nil && implicit[name] != key {
+			name += "Values"
+		}
+		implicit[name] = key
+		t := ensure(root, name)
+		t.TypeExpr = "struct"
+		t.Implicit = true
+		if !t.Pos.IsValid() {
+			t.Pos = pos
+		}
+		n.TypeExpr = name
+		if list {
+			n.TypeExpr = "[]" + name
+		}
+		return t
+	}
+	for _, r := range dotted {
+		cur := root.Child[strings.TrimSuffix(r.Path[0], "[]")]
+		for i := 1; i < len(r.Path); i++ {
+			obj := cur // the typedef of a field
+			if r.K == kParam || i > 1 {
+				obj = objectOf(cur, r.Path[:i], r.Pos)
+			}
+			cur = ensure(obj, strings.TrimSuffix(r.Path[i], "[]"))
+			if i < len(r.Path)-1 && !cur.Pos.IsValid() {
+				cur.Implicit = true
+				cur.OmitEmpty = true
+				cur.Pos = r.Pos
+			}
+		}
+		cur.Implicit = false
+		declareField(cur, r)
+	}
+	// {struct} params and fields without dotted keys below get an empty one
+	anonymous := func(n *Node, path []string) {
+		switch strings.TrimSpace(n.TypeExpr) {
+		case "struct":
+			objectOf(n, path, n.Pos)
+		case "[]struct":
+			path[len(path)-1] += "[]"
+			objectOf(n, path, n.Pos)
+		}
+	}
+	for _, k := range sortedKeys(root.Child) {
+		if n := root.Child[k]; n.IsParam {
+			anonymous(n, []string{k})
+		} else {
+			for _, f := range sortedKeys(n.Child) {
+				anonymous(n.Child[f], []string{k, f})
 			}
 		}
 	}
+	inherit(root)
 	return root
 }
 
@@ -550,6 +1344,8 @@ type gen struct {
 	imp         map[string]string
 	ff          map[string]bool
 	def         map[string]bool
+	types       map[string]string // typedef, enum or struct node name → Go type name
+	root        *Node
 }
 
 // NewGen creates a new generator instance
@@ -569,7 +1365,7 @@ func (g *gen) addImpAlias(path, alias string) {
 func (g *gen) addImp(path string) { g.addImpAlias(path, "") }
 
 func isPrimitive(t string) bool {
-	if isStringFormat(t) {
+	if IsStringFormat(t) {
 		return true
 	}
 	switch t {
@@ -578,15 +1374,61 @@ func isPrimitive(t string) bool {
 		aliasObject, aliasResources, aliasRequest, aliasLimit:
 		return true
 	default:
-		return false
+		return UnionMembers(t) != nil
 	}
 }
 
+// unionTypes are the types a scalar union may combine, in the order
+// UnionMembers lists them.
+var unionTypes = []string{"bool", "int", "int32", "int64", "float32", "float64", "string"}
+
+// UnionMembers returns the types of the scalar union t, such as bool|string,
+// in the order of unionTypes and without duplicates. intOrString is the
+// union int|string. It returns nil when t is not a union of two or more of
+// unionTypes.
+func UnionMembers(t string) []string {
+	t = strings.TrimSpace(t)
+	if t == aliasIntOrString {
+		return []string{"int", "string"}
+	}
+	if !strings.Contains(t, "|") {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, m := range strings.Split(t, "|") {
+		m = strings.TrimSpace(m)
+		if !contains(unionTypes, m) {
+			return nil
+		}
+		seen[m] = true
+	}
+	var out []string
+	for _, m := range unionTypes {
+		if seen[m] {
+			out = append(out, m)
+		}
+	}
+	if len(out) < 2 {
+		return nil
+	}
+	return out
+}
+
+// isIntOrString reports whether t is a union of an integer type and string,
+// which Kubernetes models as intstr.IntOrString. Other unions are left
+// untyped in the CRD.
+func isIntOrString(t string) bool {
+	m := UnionMembers(t)
+	return len(m) == 2 && strings.HasPrefix(m[0], "int") && m[1] == "string"
+}
+
+// camel capitalises the words of in, dropping everything but letters and
+// digits between them: cert-manager → CertManager.
 func camel(in string) string {
 	need := true
 	var b strings.Builder
 	for _, r := range in {
-		if r == '_' || r == '-' {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
 			need = true
 			continue
 		}
@@ -600,12 +1442,64 @@ func camel(in string) string {
 	return b.String()
 }
 
+// goName turns a YAML key into an exported Go identifier. Keys that do not
+// start with a cased letter get an X prefix ("1password" → X1password), so
+// the result is never empty, unexported or a keyword. Collisions between
+// keys are resolved by the callers, see fieldNames and collectDefined.
+func goName(key string) string {
+	c := camel(key)
+	if r, _ := utf8.DecodeRuneInString(c); !unicode.IsUpper(r) {
+		c = "X" + c
+	}
+	return c
+}
+
+// isTypeNode reports whether the root child n becomes a Go type of its own.
+func isTypeNode(n *Node) bool {
+	if strings.HasPrefix(n.Name, "[]") || strings.HasPrefix(n.Name, "map[") {
+		return false
+	}
+	te := strings.TrimSpace(n.TypeExpr)
+	return len(n.Enums) > 0 || len(n.Child) > 0 || te == "" || te == "struct" || n.IsAlias()
+}
+
+// typeName returns the Go type name generated for a typedef or enum.
+func (g *gen) typeName(name string) string {
+	if t, ok := g.types[name]; ok {
+		return t
+	}
+	c := goName(name)
+	if c == "Config" || c == "ConfigSpec" {
+		return "Values" + c
+	}
+	return c
+}
+
+// fieldNames returns the Go field names for the given keys of n. Keys that
+// sanitize to the same identifier are numbered in key order, so
+// "cert-manager" and "certManager" become CertManager and CertManager2.
+func fieldNames(n *Node, keys []string) map[string]string {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	out := map[string]string{}
+	used := map[string]bool{}
+	for _, k := range sorted {
+		name := goName(n.Child[k].Name)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%d", goName(n.Child[k].Name), i)
+		}
+		used[name] = true
+		out[k] = name
+	}
+	return out
+}
+
 func (g *gen) resolve(raw string) string {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
 		return "string"
 	}
-	if isStringFormat(raw) {
+	if IsStringFormat(raw) {
 		return "string"
 	}
 
@@ -616,7 +1510,7 @@ func (g *gen) resolve(raw string) string {
 	if strings.HasPrefix(raw, "map[") && strings.Contains(raw, "]") {
 		idx := strings.Index(raw, "]")
 		base := strings.TrimPrefix(strings.TrimSpace(raw[idx+1:]), "*")
-		return "map[string]" + g.resolve(base)
+		return "map[" + g.mapKey(raw[4:idx]) + "]" + g.resolve(base)
 	}
 
 	switch raw {
@@ -633,15 +1527,19 @@ func (g *gen) resolve(raw string) string {
 		g.addImpAlias("k8s.io/apimachinery/pkg/runtime", "k8sRuntime")
 		return "k8sRuntime.RawExtension"
 	}
+	if isIntOrString(raw) {
+		g.addImpAlias("k8s.io/apimachinery/pkg/util/intstr", "intstr")
+		return "intstr.IntOrString"
+	}
+	if UnionMembers(raw) != nil {
+		g.addImpAlias("k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1", "apiextensionsv1")
+		return "apiextensionsv1.JSON"
+	}
 
 	// context-aware resolution for well-known object-ish aliases
 	if raw == "resources" || raw == "request" || raw == "limit" {
 		if g.def[raw] || g.def[camel(raw)] {
-			c := camel(raw)
-			if c == "Config" || c == "ConfigSpec" {
-				return "Values" + c
-			}
-			return c
+			return g.typeName(raw)
 		}
 		g.addImpAlias("k8s.io/apimachinery/pkg/runtime", "k8sRuntime")
 		return "k8sRuntime.RawExtension"
@@ -652,18 +1550,9 @@ func (g *gen) resolve(raw string) string {
 	}
 	if idx := strings.LastIndex(raw, "."); idx != -1 {
 		g.addImpAlias(raw[:idx], "")
-		out := raw[idx+1:]
-		c := camel(out)
-		if c == "Config" || c == "ConfigSpec" {
-			return "Values" + c
-		}
-		return c
-	}
-	c := camel(raw)
-	if c == "Config" || c == "ConfigSpec" {
-		return "Values" + c
+		return g.typeName(raw[idx+1:])
 	}
-	return c
+	return g.typeName(raw)
 }
 
 func (g *gen) goType(n *Node) string {
@@ -671,11 +1560,7 @@ func (g *gen) goType(n *Node) string {
 	// For nodes that are containers (have children) and TypeExpr is empty or "struct",
 	// return the camelCased node name as the struct type
 	if (raw == "" || raw == "struct") && len(n.Child) > 0 {
-		c := camel(n.Name)
-		if c == "Config" || c == "ConfigSpec" {
-			return "Values" + c
-		}
-		return c
+		return g.typeName(n.Name)
 	}
 	if raw == "" {
 		return "string"
@@ -690,11 +1575,73 @@ func (g *gen) goType(n *Node) string {
 	if strings.HasPrefix(raw, "map[") && strings.Contains(raw, "]") {
 		idx := strings.Index(raw, "]")
 		base := strings.TrimPrefix(strings.TrimSpace(raw[idx+1:]), "*")
-		return "map[string]" + g.resolve(base)
+		return "map[" + g.mapKey(raw[4:idx]) + "]" + g.resolve(base)
 	}
 	return g.resolve(raw)
 }
 
+// mapKey returns the Go key type of a map: the enum type for string enums,
+// string otherwise.
+func (g *gen) mapKey(key string) string {
+	if keyEnum(g.root, key) != nil {
+		return g.typeName(strings.TrimSpace(key))
+	}
+	return "string"
+}
+
+// mapKeyType returns the key type of the map type expression te, such as
+// Size for map[Size]User, or "" when te is not a map.
+func mapKeyType(te string) string {
+	te = strings.TrimPrefix(strings.TrimSpace(te), "*")
+	if !strings.HasPrefix(te, "map[") || !strings.Contains(te, "]") {
+		return ""
+	}
+	return strings.TrimSpace(te[4:strings.Index(te, "]")])
+}
+
+// keyEnum returns the string enum named key, which maps may be keyed by, or
+// nil.
+func keyEnum(root *Node, key string) *Node {
+	if root == nil {
+		return nil
+	}
+	e, ok := root.Child[strings.TrimSpace(key)]
+	if !ok || e.IsParam || len(e.Enums) == 0 {
+		return nil
+	}
+	if te := strings.TrimSpace(e.TypeExpr); te != "" && te != "string" {
+		return nil
+	}
+	return e
+}
+
+// keyRules returns the CEL rules that restrict the keys of map c to its
+// enum key type and @keyPattern. The CRD cannot carry propertyNames.
+func keyRules(root, c *Node) []Validation {
+	key := mapKeyType(c.TypeExpr)
+	if key == "" {
+		return nil
+	}
+	var out []Validation
+	if e := keyEnum(root, key); e != nil {
+		quoted := make([]string, len(e.Enums))
+		for i, v := range e.Enums {
+			quoted[i] = strconv.Quote(v)
+		}
+		out = append(out, Validation{
+			Rule:    "self.all(k, k in [" + strings.Join(quoted, ", ") + "])",
+			Message: c.Name + " keys must be one of " + strings.Join(e.Enums, ", "),
+		})
+	}
+	if c.KeyPattern != "" {
+		out = append(out, Validation{
+			Rule:    "self.all(k, k.matches(" + strconv.Quote(c.KeyPattern) + "))",
+			Message: c.Name + " keys must match " + c.KeyPattern,
+		})
+	}
+	return out
+}
+
 func quoteEnums(vals []string) string {
 	quoted := make([]string, len(vals))
 	for i, v := range vals {
@@ -712,10 +1659,7 @@ func (g *gen) writeEnum(n *Node) {
 		return
 	}
 
-	name := camel(n.Name)
-	if name == "Config" || name == "ConfigSpec" {
-		name = "Values" + name
-	}
+	name := g.typeName(n.Name)
 
 	// Get base type
 	baseType := n.TypeExpr
@@ -742,14 +1686,19 @@ func (g *gen) writeStruct(n *Node) {
 		g.buf.WriteString("    Spec              ConfigSpec `json:\"spec,omitempty\"`\n")
 		g.buf.WriteString("}\n\n")
 
+		for _, m := range typeMarkers(n, true) {
+			g.buf.WriteString("// " + m + "\n")
+		}
 		g.buf.WriteString("type ConfigSpec struct {\n")
-		keys := sortedKeysByOrder(n.Child)
-		for _, k := range keys {
-			c := n.Child[k]
-			if !c.IsParam {
-				continue
+		var params []string
+		for _, k := range sortedKeysByOrder(n.Child) {
+			if n.Child[k].IsParam {
+				params = append(params, k)
 			}
-			g.emitField(c)
+		}
+		fields := fieldNames(n, params)
+		for _, k := range params {
+			g.emitField(n.Child[k], fields[k])
 		}
 		g.buf.WriteString("}\n\n")
 
@@ -763,89 +1712,192 @@ func (g *gen) writeStruct(n *Node) {
 		return
 	}
 
-	name := camel(n.Name)
-	if name == "Config" || name == "ConfigSpec" {
-		name = "Values" + name
-	}
+	name := g.typeName(n.Name)
 
+	for _, m := range typeMarkers(n, false) {
+		g.buf.WriteString("// " + m + "\n")
+	}
 	g.buf.WriteString(fmt.Sprintf("type %s struct {\n", name))
-	keys := sortedKeysByOrder(n.Child)
+	for _, e := range n.Embeds {
+		g.buf.WriteString(fmt.Sprintf("    %s `json:\",inline\"`\n", g.typeName(e.Type)))
+	}
+	var keys []string
+	for _, k := range sortedKeysByOrder(n.Child) {
+		if !inherited(n, n.Child[k]) {
+			keys = append(keys, k)
+		}
+	}
+	fields := fieldNames(n, keys)
 	for _, k := range keys {
-		g.emitField(n.Child[k])
+		g.emitField(n.Child[k], fields[k])
 	}
 	g.buf.WriteString("}\n\n")
 
 	for _, k := range sortedKeys(n.Child) {
-		g.writeStruct(n.Child[k])
+		if !inherited(n, n.Child[k]) {
+			g.writeStruct(n.Child[k])
+		}
 	}
 }
 
-func (g *gen) emitField(c *Node) {
-	field := camel(c.Name)
+func (g *gen) emitField(c *Node, field string) {
 	typ := g.goType(c)
 
-	if c.Comment != "" {
-		g.buf.WriteString("    // " + c.Comment + "\n")
+	if doc := c.Documentation(); doc != "" {
+		for _, line := range strings.Split(doc, "\n") {
+			if line == "" {
+				g.buf.WriteString("    //\n")
+				continue
+			}
+			g.buf.WriteString("    // " + line + "\n")
+		}
+	}
+
+	for _, m := range g.fieldMarkers(c, typ) {
+		g.buf.WriteString("    // " + m + "\n")
 	}
 
-	if f := strings.TrimPrefix(strings.TrimSpace(c.TypeExpr), "*"); isStringFormat(f) &&
+	tag := "`json:\"" + c.Name
+	if isOmitEmpty(c, typ) {
+		tag += ",omitempty"
+	}
+	tag += "\"`"
+	g.buf.WriteString(fmt.Sprintf("    %s %s %s\n", field, typ, tag))
+}
+
+// isOmitEmpty reports whether the JSON tag of c gets omitempty: slices, maps,
+// pointers, or optional fields. @required fields of these types keep it, as
+// the +required marker decides.
+func isOmitEmpty(c *Node, typ string) bool {
+	if u := underlyingOf(c); u != c.TypeExpr {
+		typ = u // an alias of a slice, map or pointer
+	}
+	return strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || strings.HasPrefix(typ, "*") || c.OmitEmpty
+}
+
+// fieldMarkers returns the kubebuilder markers for field c of Go type typ.
+// Both the Go emitter and the native schema generator consume this list.
+func (g *gen) fieldMarkers(c *Node, typ string) []string {
+	out := []string{"+optional"}
+	if c.IsRequired() {
+		out[0] = "+required"
+	}
+	if c.Parent != nil && c.Parent.Discriminator == c.Name {
+		out = append(out, "+unionDiscriminator")
+	}
+
+	if f := strings.TrimPrefix(strings.TrimSpace(c.TypeExpr), "*"); IsStringFormat(f) &&
 		!strings.HasPrefix(typ, "[]") && !strings.HasPrefix(typ, "map[") {
-		g.buf.WriteString("    // +kubebuilder:validation:Format=" + f + "\n")
+		out = append(out, "+kubebuilder:validation:Format="+f)
 	}
 
 	if len(c.Enums) > 0 {
-		g.buf.WriteString("    // +kubebuilder:validation:Enum=" + quoteEnums(c.Enums) + "\n")
+		out = append(out, "+kubebuilder:validation:Enum="+quoteEnums(c.Enums))
+	}
+
+	// Defaults and examples are formatted for the type an alias names
+	if u := Underlying(g.root, c.TypeExpr); u != c.TypeExpr {
+		typ = g.goType(&Node{TypeExpr: u})
 	}
 
 	// Emit default value if it was explicitly set (even if empty string)
 	if c.HasDefaultVal && c.DefaultVal != "" {
 		if def := formatDefault(c.DefaultVal, typ); def != "" {
-			g.buf.WriteString("    // +kubebuilder:default:=" + def + "\n")
+			out = append(out, "+kubebuilder:default:="+def)
 		}
 	} else if c.HasDefaultVal && c.DefaultVal == "" {
 		// Empty string default value - still emit it
 		baseType := strings.TrimPrefix(typ, "*")
 		if baseType == "string" || baseType == "quantity" {
-			g.buf.WriteString("    // +kubebuilder:default:=\"\"\n")
+			out = append(out, "+kubebuilder:default:=\"\"")
 		}
 	}
 
 	// Emit validation constraints
 	if c.Minimum != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:Minimum=%v\n", *c.Minimum))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:Minimum=%v", *c.Minimum))
 	}
 	if c.Maximum != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:Maximum=%v\n", *c.Maximum))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:Maximum=%v", *c.Maximum))
 	}
 	if c.ExclusiveMinimum {
-		g.buf.WriteString("    // +kubebuilder:validation:ExclusiveMinimum=true\n")
+		out = append(out, "+kubebuilder:validation:ExclusiveMinimum=true")
 	}
 	if c.ExclusiveMaximum {
-		g.buf.WriteString("    // +kubebuilder:validation:ExclusiveMaximum=true\n")
+		out = append(out, "+kubebuilder:validation:ExclusiveMaximum=true")
 	}
 	if c.MinLength != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:MinLength=%d\n", *c.MinLength))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MinLength=%d", *c.MinLength))
 	}
 	if c.MaxLength != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:MaxLength=%d\n", *c.MaxLength))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MaxLength=%d", *c.MaxLength))
 	}
 	if c.Pattern != "" {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:Pattern=%q\n", c.Pattern))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:Pattern=%q", c.Pattern))
 	}
 	if c.MinItems != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:MinItems=%d\n", *c.MinItems))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MinItems=%d", *c.MinItems))
 	}
 	if c.MaxItems != nil {
-		g.buf.WriteString(fmt.Sprintf("    // +kubebuilder:validation:MaxItems=%d\n", *c.MaxItems))
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MaxItems=%d", *c.MaxItems))
+	}
+	if c.ListType != "" {
+		out = append(out, "+listType="+c.ListType)
+	}
+	for _, k := range c.ListMapKeys {
+		out = append(out, "+listMapKey="+k)
+	}
+	if c.MinProperties != nil {
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MinProperties=%d", *c.MinProperties))
+	}
+	if c.MaxProperties != nil {
+		out = append(out, fmt.Sprintf("+kubebuilder:validation:MaxProperties=%d", *c.MaxProperties))
 	}
 
-	tag := "`json:\"" + c.Name
-	// Add omitempty for: slices, maps, pointers, or fields explicitly marked with []
-	if strings.HasPrefix(typ, "[]") || strings.HasPrefix(typ, "map[") || strings.HasPrefix(typ, "*") || c.OmitEmpty {
-		tag += ",omitempty"
+	// OpenAPI has room for a single example; values.schema.json lists all
+	// of them, see withHints.
+	if len(c.Examples) > 0 {
+		if ex := formatDefault(c.Examples[0].Value, typ); ex != "" {
+			out = append(out, "+kubebuilder:example="+ex)
+		}
 	}
-	tag += "\"`"
-	g.buf.WriteString(fmt.Sprintf("    %s %s %s\n", field, typ, tag))
+	out = append(out, validationMarkers(keyRules(g.root, c))...)
+	out = append(out, validationMarkers(c.Validations)...)
+	if c.Immutable {
+		out = append(out, validationMarkers([]Validation{{Rule: "self == oldSelf", Message: c.Name + " is immutable"}})...)
+	}
+	return out
+}
+
+// typeMarkers returns the markers of the struct generated for n: its
+// @validate rules, the rules of its @requiredIf params or fields and, for a
+// @union, +union and the rule that picks its member.
+// params selects the top-level ConfigSpec view of the root.
+func typeMarkers(n *Node, params bool) []string {
+	var vs []Validation
+	if !n.IsParam {
+		vs = append(vs, n.Validations...)
+	}
+	vs = append(vs, conditionRules(n, params)...)
+	out := validationMarkers(append(vs, unionRules(n)...))
+	if len(n.Variants) > 0 {
+		out = append([]string{"+union"}, out...)
+	}
+	return out
+}
+
+// validationMarkers returns the XValidation markers of the @validate rules.
+// They apply to fields as well as to typedefs.
+func validationMarkers(vs []Validation) []string {
+	var out []string
+	for _, v := range vs {
+		m := "+kubebuilder:validation:XValidation:rule=" + strconv.Quote(v.Rule)
+		if v.Message != "" {
+			m += ",message=" + strconv.Quote(v.Message)
+		}
+		out = append(out, m)
+	}
+	return out
 }
 
 func (g *gen) ensureFreeFormTypeFor(fieldOwner, fieldName string) string {
@@ -860,17 +1912,27 @@ func (g *gen) ensureFreeFormTypeFor(fieldOwner, fieldName string) string {
 	return typeName
 }
 
-func (g *gen) Generate(root *Node) ([]byte, []byte, error) {
-	if undef := CollectUndefined(root); len(undef) > 0 {
-		return nil, nil, fmt.Errorf("undefined types: %s", strings.Join(undef, ", "))
+// collectDefined records the complex types (nodes with children) so that
+// resolve can tell user-defined types from well-known aliases, and names
+// the Go types of root. Names that sanitize to the same identifier are
+// numbered in name order, e.g. typedef Db and param db with fields.
+func (g *gen) collectDefined(root *Node) {
+	g.root = root
+	g.types = map[string]string{}
+	used := map[string]bool{"Config": true, "ConfigSpec": true}
+	for _, k := range sortedKeys(root.Child) {
+		if !isTypeNode(root.Child[k]) {
+			continue
+		}
+		base := g.typeName(k)
+		name := base
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+		used[name] = true
+		g.types[k] = name
 	}
-	g.buf.WriteString("// Code generated by values-gen. DO NOT EDIT.\n")
-	g.buf.WriteString("// +kubebuilder:object:generate=true\n")
-	g.buf.WriteString("// +groupName=" + g.groupName + "\n")
-	g.buf.WriteString("// +versionName=" + g.versionName + "\n")
-	g.buf.WriteString("package " + g.pkg + "\n\n")
 
-	// collect defined complex types (have children)
 	g.def = map[string]bool{}
 	var walk func(n *Node)
 	walk = func(n *Node) {
@@ -883,7 +1945,22 @@ func (g *gen) Generate(root *Node) ([]byte, []byte, error) {
 		}
 	}
 	walk(root)
+}
+
+func (g *gen) Generate(root *Node) ([]byte, []byte, error) {
+	if err := undefinedError(root); err != nil {
+		return nil, nil, err
+	}
+	if err := embedError(root); err != nil {
+		return nil, nil, err
+	}
+	g.buf.WriteString("// Code generated by values-gen. DO NOT EDIT.\n")
+	g.buf.WriteString("// +kubebuilder:object:generate=true\n")
+	g.buf.WriteString("// +groupName=" + g.groupName + "\n")
+	g.buf.WriteString("// +versionName=" + g.versionName + "\n")
+	g.buf.WriteString("package " + g.pkg + "\n\n")
 
+	g.collectDefined(root)
 	g.writeStruct(root)
 
 	// Generate enum types
@@ -893,6 +1970,11 @@ func (g *gen) Generate(root *Node) ([]byte, []byte, error) {
 			g.writeEnum(c)
 		}
 	}
+	for _, k := range sortedKeys(root.Child) {
+		if c := root.Child[k]; c.IsAlias() {
+			g.writeAlias(c)
+		}
+	}
 
 	var src []byte
 	if len(g.imp) > 0 {
@@ -962,9 +2044,12 @@ func WriteGeneratedGoAndStub(root *Node, module, groupName, versionName string)
 go 1.20
 
 require (
+	k8s.io/apiextensions-apiserver v0.0.0
 	k8s.io/apimachinery v0.0.0
 )
 
+replace k8s.io/apiextensions-apiserver => ./k8s.io/apiextensions-apiserver
+
 replace k8s.io/apimachinery => ./k8s.io/apimachinery
 `
 	if err := os.WriteFile(filepath.Join(tmpdir, "go.mod"), []byte(goMod), 0o644); err != nil {
@@ -1045,7 +2130,8 @@ type IntOrString struct{}
 		return "", "", err
 	}
 
-	/* --------- stub for apiextensions-apiserver/pkg/apis/apiextensions/v1 --- */
+	/* ---------- stub k8s.io/apimachinery/pkg/runtime ---------- */
+
 	rtDir := filepath.Join(stubModuleDir, "pkg/runtime")
 	if err := os.MkdirAll(rtDir, 0o755); err != nil {
 		return "", "", err
@@ -1057,6 +2143,27 @@ type RawExtension struct{}
 		return "", "", err
 	}
 
+	/* ---------- stub k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1 ---------- */
+
+	extModuleDir := filepath.Join(tmpdir, "k8s.io/apiextensions-apiserver")
+	extDir := filepath.Join(extModuleDir, "pkg/apis/apiextensions/v1")
+	if err := os.MkdirAll(extDir, 0o755); err != nil {
+		return "", "", err
+	}
+	extMod := `module k8s.io/apiextensions-apiserver
+
+go 1.20
+`
+	if err := os.WriteFile(filepath.Join(extModuleDir, "go.mod"), []byte(extMod), 0o644); err != nil {
+		return "", "", err
+	}
+	stubJSON := `package v1
+type JSON struct{}
+`
+	if err := os.WriteFile(filepath.Join(extDir, "doc.go"), []byte(stubJSON), 0o644); err != nil {
+		return "", "", err
+	}
+
 	return tmpdir, goFilePath, nil
 }
 
@@ -1129,23 +2236,34 @@ func WriteValuesSchema(crdBytes []byte, outPath string) error {
 }
 
 func WriteValuesSchemaWithOrder(crdBytes []byte, outPath string, root *Node) error {
+	data, err := ValuesSchema(crdBytes, root)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, data, 0o644)
+}
+
+// ValuesSchema renders values.schema.json from the CRD. When root is given,
+// properties keep the declaration order of the params.
+func ValuesSchema(crdBytes []byte, root *Node) ([]byte, error) {
 	docs := bytes.Split(crdBytes, []byte("\n---"))
 	if len(docs) == 0 {
-		return fmt.Errorf("empty CRD data")
+		return nil, fmt.Errorf("empty CRD data")
 	}
 
 	var obj apiextv1.CustomResourceDefinition
 	if err := sigyaml.Unmarshal(docs[0], &obj); err != nil {
-		return err
+		return nil, err
 	}
 	if len(obj.Spec.Versions) == 0 {
-		return fmt.Errorf("CRD has no versions")
+		return nil, fmt.Errorf("CRD has no versions")
 	}
 
 	specSchema := obj.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
 
 	if root != nil {
 		keys := sortedKeysByOrder(root.Child)
+		hints := hasHints(root)
 
 		var buf bytes.Buffer
 		buf.WriteString("{\n")
@@ -1164,7 +2282,12 @@ func WriteValuesSchemaWithOrder(crdBytes []byte, outPath string, root *Node) err
 
 					propJSON, err := json.MarshalIndent(prop, "    ", "  ")
 					if err != nil {
-						return err
+						return nil, err
+					}
+					if hints {
+						if propJSON, err = withHints(propJSON, node, root); err != nil {
+							return nil, err
+						}
 					}
 
 					buf.WriteString(fmt.Sprintf("    \"%s\": %s", key, string(propJSON)))
@@ -1172,10 +2295,32 @@ func WriteValuesSchemaWithOrder(crdBytes []byte, outPath string, root *Node) err
 			}
 		}
 
-		buf.WriteString("\n  }\n")
-		buf.WriteString("}\n")
+		buf.WriteString("\n  }")
+		// Params marked @required, in declaration order: implied ones would
+		// reject partial overrides of values.yaml
+		var required []string
+		for _, key := range keys {
+			if n := root.Child[key]; n.IsParam && n.Required {
+				required = append(required, key)
+			}
+		}
+		if len(required) > 0 {
+			req, err := json.MarshalIndent(required, "  ", "  ")
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(",\n  \"required\": " + string(req))
+		}
+		if conds := conditionSchemas(root, true); len(conds) > 0 {
+			allOf, err := json.MarshalIndent(conds, "  ", "  ")
+			if err != nil {
+				return nil, err
+			}
+			buf.WriteString(",\n  \"allOf\": " + string(allOf))
+		}
+		buf.WriteString("\n}\n")
 
-		return os.WriteFile(outPath, buf.Bytes(), 0o644)
+		return buf.Bytes(), nil
 	}
 
 	// Fallback
@@ -1189,11 +2334,158 @@ func WriteValuesSchemaWithOrder(crdBytes []byte, outPath string, root *Node) err
 		Properties: specSchema.Properties,
 	}
 
-	buf, err := json.MarshalIndent(out, "", "  ")
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// hasHints reports whether any param or field below n has an @example, is
+// @immutable, has a condition, is a set, restricts its map keys, holds a
+// scalar union or is a @union.
+func hasHints(n *Node) bool {
+	for _, c := range n.Child {
+		key := mapKeyType(c.TypeExpr)
+		if len(c.Examples) > 0 || c.Immutable || c.RequiredIf != nil || c.VisibleIf != nil ||
+			c.ListType == "set" || c.KeyPattern != "" || (key != "" && key != "string") ||
+			UnionMembers(BaseType(c.TypeExpr)) != nil || len(c.Variants) > 0 || hasHints(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// withHints adds the JSON Schema "examples" keyword, listing every @example,
+// next to the OpenAPI "example" in the schema of param n and of the fields
+// reachable from it, and marks @immutable ones with "x-immutable" for UIs to
+// lock them after install. @requiredIf becomes an if/then in the "allOf" of
+// the object holding the field, and @visibleIf an "x-visible-if" that maps
+// the tested path to its value. A @union gets a "oneOf" of its variants.
+// Map keys restricted by an enum key type or
+// @keyPattern get "propertyNames", and sets get "uniqueItems", which CRDs
+// express with x-kubernetes-list-type. Scalar unions other than int|string,
+// which the CRD leaves untyped, get an "anyOf" of their types. Key order of
+// the schema is preserved.
+func withHints(schema []byte, n, root *Node) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	obj, ok := v.(jsonObject)
+	if !ok {
+		return schema, nil
 	}
-	return os.WriteFile(outPath, buf, 0o644)
+	w := &hintWalker{root: root, seen: map[string]bool{}}
+	return json.MarshalIndent(w.node(obj, n), "    ", "  ")
+}
+
+type hintWalker struct {
+	root *Node
+	seen map[string]bool // typedefs being walked, against recursive types
+}
+
+func (w *hintWalker) node(s jsonObject, n *Node) jsonObject {
+	if len(n.Examples) > 0 {
+		var vals []interface{}
+		for _, ex := range n.ExampleValues() {
+			var v interface{}
+			if err := sigyaml.Unmarshal([]byte(ex), &v); err == nil {
+				vals = append(vals, v)
+			}
+		}
+		s = s.insertAfter("example", jsonMember{Key: "examples", Value: vals})
+	}
+	if n.Immutable {
+		s = append(s, jsonMember{Key: "x-immutable", Value: true})
+	}
+	if n.ListType == "set" {
+		s = s.insertAfter("items", jsonMember{Key: "uniqueItems", Value: true})
+	}
+	if pn := propertyNames(w.root, n); len(pn) > 0 {
+		s = s.insertAfter("additionalProperties", jsonMember{Key: "propertyNames", Value: pn})
+	}
+	if n.VisibleIf != nil {
+		if v, err := n.VisibleIf.resolve(n.Parent); err == nil {
+			s = append(s, jsonMember{Key: "x-visible-if", Value: jsonObject{{Key: strings.Join(n.VisibleIf.Path, "."), Value: v}}})
+		}
+	}
+	return w.typ(s, n.TypeExpr)
+}
+
+func (w *hintWalker) typ(s jsonObject, t string) jsonObject {
+	t = strings.TrimPrefix(strings.TrimSpace(t), "*")
+	switch {
+	case strings.HasPrefix(t, "[]"):
+		if items, ok := s.get("items"); ok {
+			s.set("items", w.typ(items, t[2:]))
+		}
+		return s
+	case strings.HasPrefix(t, "map[") && strings.Contains(t, "]"):
+		if elem, ok := s.get("additionalProperties"); ok {
+			s.set("additionalProperties", w.typ(elem, t[strings.Index(t, "]")+1:]))
+		}
+		return s
+	}
+	if m := UnionMembers(t); m != nil && !isIntOrString(t) {
+		return s.insertAfter("x-kubernetes-preserve-unknown-fields", jsonMember{Key: "anyOf", Value: unionSchemas(m)})
+	}
+	def, ok := w.root.Child[t]
+	if ok && def.IsAlias() {
+		if !w.seen[t] {
+			w.seen[t] = true
+			s = w.node(s, def)
+			delete(w.seen, t)
+		}
+		return s
+	}
+	props, hasProps := s.get("properties")
+	if !ok || !hasProps || w.seen[t] {
+		return s
+	}
+	w.seen[t] = true
+	for i, m := range props {
+		c, ok := def.Child[m.Key]
+		if obj, isObj := m.Value.(jsonObject); ok && isObj {
+			props[i].Value = w.node(obj, c)
+		}
+	}
+	delete(w.seen, t)
+	if conds := conditionSchemas(def, false); len(conds) > 0 {
+		s = append(s, jsonMember{Key: "allOf", Value: conds})
+	}
+	if len(def.Variants) > 0 {
+		s = append(s, jsonMember{Key: "oneOf", Value: variantSchemas(def)})
+	}
+	return s
+}
+
+// unionSchemas returns the JSON Schemas of the types of a scalar union.
+func unionSchemas(members []string) []interface{} {
+	var out []interface{}
+	seen := map[string]bool{}
+	for _, m := range members {
+		s, _ := builtinSchema(m)
+		if !seen[s.Type] {
+			seen[s.Type] = true
+			out = append(out, jsonObject{{Key: "type", Value: s.Type}})
+		}
+	}
+	return out
+}
+
+// propertyNames returns the JSON Schema for the keys of map n, see keyRules.
+func propertyNames(root, n *Node) jsonObject {
+	key := mapKeyType(n.TypeExpr)
+	if key == "" {
+		return nil
+	}
+	var out jsonObject
+	if e := keyEnum(root, key); e != nil {
+		out = append(out, jsonMember{Key: "enum", Value: e.Enums})
+	}
+	if n.KeyPattern != "" {
+		out = append(out, jsonMember{Key: "pattern", Value: n.KeyPattern})
+	}
+	return out
 }
 
 /* -------------------------------------------------------------------------- */
@@ -1203,7 +2495,10 @@ func WriteValuesSchemaWithOrder(crdBytes []byte, outPath string, root *Node) err
 func PopulateDefaults(n *Node, y interface{}, aliases map[string]*Node) {
 	switch v := y.(type) {
 	case map[string]interface{}:
-		for k, yval := range v {
+		// Sorted keys: a typedef shared by several params takes its defaults
+		// from the first instance visited, which must not depend on map order.
+		for _, k := range sortedKeys(v) {
+			yval := v[k]
 			child, ok := n.Child[k]
 			if !ok || yval == nil {
 				continue
@@ -1219,7 +2514,7 @@ func PopulateDefaults(n *Node, y interface{}, aliases map[string]*Node) {
 			case map[string]interface{}:
 				isObj := len(child.Child) > 0
 				var alias *Node
-				if te := strings.TrimPrefix(child.TypeExpr, "*"); te != "" {
+				if te := strings.TrimPrefix(underlyingOf(child), "*"); te != "" {
 					if a, ok := aliases[te]; ok {
 						alias = a
 						if len(a.Child) > 0 {
@@ -1227,6 +2522,11 @@ func PopulateDefaults(n *Node, y interface{}, aliases map[string]*Node) {
 						}
 					}
 				}
+				// A @union defaults as a whole: defaults of its members
+				// would set them whatever the discriminator says
+				if alias != nil && len(alias.Variants) > 0 {
+					isObj = false
+				}
 
 				if isObj {
 					if !child.HasDefaultVal {
@@ -1314,34 +2614,69 @@ func formatDefault(val, typ string) string {
 	return val
 }
 
-func CollectUndefined(root *Node) []string {
-	defined := map[string]struct{}{}
-	referenced := map[string]struct{}{}
-
-	baseOf := func(expr string) string {
-		expr = strings.TrimSpace(expr)
-		if expr == "" {
-			return ""
-		}
+// BaseType strips pointer, slice and map wrappers from a type expression.
+func BaseType(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return ""
+	}
+	if strings.HasPrefix(expr, "*") {
+		expr = strings.TrimPrefix(expr, "*")
+	}
+	if strings.HasPrefix(expr, "[]") {
+		expr = strings.TrimSpace(expr[2:])
 		if strings.HasPrefix(expr, "*") {
 			expr = strings.TrimPrefix(expr, "*")
 		}
-		if strings.HasPrefix(expr, "[]") {
-			expr = strings.TrimSpace(expr[2:])
+	}
+	if strings.HasPrefix(expr, "map[") {
+		if i := strings.Index(expr, "]"); i != -1 {
+			expr = strings.TrimSpace(expr[i+1:])
 			if strings.HasPrefix(expr, "*") {
 				expr = strings.TrimPrefix(expr, "*")
 			}
 		}
-		if strings.HasPrefix(expr, "map[") {
-			if i := strings.Index(expr, "]"); i != -1 {
-				expr = strings.TrimSpace(expr[i+1:])
-				if strings.HasPrefix(expr, "*") {
-					expr = strings.TrimPrefix(expr, "*")
-				}
+	}
+	return expr
+}
+
+// undefinedError reports the undefined types of root, followed by a
+// diagnostic for every annotation that references one of them.
+func undefinedError(root *Node) error {
+	undef := CollectUndefined(root)
+	if len(undef) == 0 {
+		return nil
+	}
+	missing := map[string]bool{}
+	for _, t := range undef {
+		missing[t] = true
+	}
+
+	var refs []*Node
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		for _, k := range sortedKeys(n.Child) {
+			c := n.Child[k]
+			if missing[BaseType(c.TypeExpr)] && c.Pos.IsValid() {
+				refs = append(refs, c)
 			}
+			walk(c)
 		}
-		return expr
 	}
+	walk(root)
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Pos.Line < refs[j].Pos.Line })
+
+	msg := "undefined types: " + strings.Join(undef, ", ")
+	for _, n := range refs {
+		b := BaseType(n.TypeExpr)
+		msg += "\n" + diag.Errorf(n.Pos.Find("{").Find(b), "undefined type %q", b).Error()
+	}
+	return errors.New(msg)
+}
+
+func CollectUndefined(root *Node) []string {
+	defined := map[string]struct{}{}
+	referenced := map[string]struct{}{}
 
 	var walk func(n *Node)
 	walk = func(n *Node) {
@@ -1356,12 +2691,12 @@ func CollectUndefined(root *Node) []string {
 				!strings.HasPrefix(base, "map[") {
 				// Type is defined if it has children, enums, or if it's a typedef (has TypeExpr "struct")
 				// This allows empty structs (typedefs without fields) to be considered defined
-				if len(n.Child) > 0 || len(n.Enums) > 0 || n.TypeExpr == "struct" {
+				if len(n.Child) > 0 || len(n.Enums) > 0 || n.TypeExpr == "struct" || n.IsAlias() {
 					defined[base] = struct{}{}
 				}
 			}
 		}
-		if b := baseOf(n.TypeExpr); b != "" {
+		if b := BaseType(n.TypeExpr); b != "" {
 			if b != aliasObject && b != aliasEmptyObject &&
 				b != "struct" && b != "object" &&
 				b != aliasResources && b != aliasRequest && b != aliasLimit &&
@@ -310,14 +310,14 @@ metricsStorages:
 /* -------------------------------------------------------------------------- */
 
 /* -------------------------------------------------------------------------- */
-/*  table-driven check for isStringFormat                                      */
+/*  table-driven check for IsStringFormat                                      */
 /* -------------------------------------------------------------------------- */
 
 func TestIsStringFormat(t *testing.T) {
 	for _, f := range stringFormats {
-		require.Truef(t, isStringFormat(f), "expected %s to be recognised", f)
+		require.Truef(t, IsStringFormat(f), "expected %s to be recognised", f)
 	}
-	require.False(t, isStringFormat("not_a_format"))
+	require.False(t, IsStringFormat("not_a_format"))
 }
 
 /* -------------------------------------------------------------------------- */
@@ -1447,3 +1447,426 @@ func TestFieldConstraintsInBuild(t *testing.T) {
 	require.NotNil(t, portNode.Maximum)
 	require.Equal(t, 65535.0, *portNode.Maximum)
 }
+
+func TestParseRecordsPositions(t *testing.T) {
+	const yaml = `## @typedef {struct} Foo - Foo
+## @field {Bar} bar - Bar
+
+## @param {Foo} foo - Foo
+foo: {}
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, 1, rows[0].Pos.Line)
+	require.Equal(t, 2, rows[1].Pos.Line)
+	require.Equal(t, 4, rows[2].Pos.Line)
+	require.Equal(t, 4, rows[2].Pos.Col)
+
+	root := Build(rows)
+	require.Equal(t, 2, root.Child["Foo"].Child["bar"].Pos.Line)
+
+	_, _, err = NewGen("values", "values.helm.io", "v1alpha1").Generate(root)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "undefined types: Bar")
+	require.Contains(t, err.Error(), tmp+":2:12: undefined type \"Bar\"")
+	require.Contains(t, err.Error(), "## @field {Bar} bar - Bar\n               ^")
+}
+
+func TestParseKeepsOrphanFields(t *testing.T) {
+	const yaml = `## @field {string} stray - Before any typedef
+## @param {string} name - Name
+name: x
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.True(t, rows[0].IsField())
+	require.Equal(t, []string{"stray"}, rows[0].Path)
+
+	root := Build(rows)
+	require.Len(t, root.Child, 1)
+	require.Contains(t, root.Child, "name")
+}
+
+func TestParseRejectsUnknownTags(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"misspelled field", "## @typedef {struct} Db - Db\n## @feild {string} host - Host\n", "2:4: unknown annotation @feild (did you mean @field?)"},
+		{"misspelled constraint", "## @param {int} a - A\n## @minimun 1\na: 1\n", "2:4: unknown annotation @minimun (did you mean @minimum?)"},
+		{"case typo", "## @param {int} a - A\n## @maxlength 3\na: 1\n", "did you mean @maxLength?"},
+		{"no suggestion", "## @param {int} a - A\n## @schema {}\na: 1\n", "unknown annotation @schema (use --allow-tag"},
+		{"malformed", "## @param {int} a - A\n## @minimum abc\na: 1\n", "malformed @minimum annotation"},
+		{"stray constraint", "## @typedef {struct} Db - Db\n## @minimum 1\n", "@minimum must follow a @param or @field"},
+		{"stray value", "## @value a\n", "@value must follow an @enum"},
+		{"stray example", "## @typedef {struct} Db - Db\n## @example {}\n", "@example must follow a @param or @field"},
+		{"empty example", "## @param {int} a - A\n## @example\n##\na: 1\n", "2:4: @example for \"a\" has no value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := writeTempFile(tt.yaml)
+			defer os.Remove(tmp)
+			_, err := Parse(tmp)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestParseAllowTags(t *testing.T) {
+	const yaml = `## @param {int} a - A
+## @schema {"x": 1}
+## @minimum 1
+## @section Other
+## @maximum 5
+a: 1
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := ParseWithOptions(tmp, ParseOptions{AllowTags: []string{"@schema"}})
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, 1.0, *rows[0].Minimum)
+	require.Equal(t, 5.0, *rows[0].Maximum)
+}
+
+func TestExpandTypeAlias(t *testing.T) {
+	aliases := map[string]string{"Port": "int32", "Labels": "map[string]string"}
+	require.Equal(t, "int32", ExpandTypeAlias("Port", aliases))
+	require.Equal(t, "[]*int32", ExpandTypeAlias("[]*Port", aliases))
+	require.Equal(t, "?int32", ExpandTypeAlias("?Port", aliases))
+	require.Equal(t, "map[string]map[string]string", ExpandTypeAlias("map[string]Labels", aliases))
+	require.Equal(t, "[]Ports", ExpandTypeAlias("[]Ports", aliases))
+	require.Equal(t, "Port", ExpandTypeAlias("Port", nil))
+}
+
+func TestParseTypeAliases(t *testing.T) {
+	const yaml = `## @typedef {struct} Svc - Svc
+## @field {Port} port - Port
+
+## @param {[]Port} ports - Ports
+## @param {Svc} svc - Svc
+ports: [80]
+svc:
+  port: 80
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := ParseWithOptions(tmp, ParseOptions{TypeAliases: map[string]string{"Port": "int32"}})
+	require.NoError(t, err)
+	require.Equal(t, "int32", rows[1].TypeExpr)
+	require.Equal(t, "[]int32", rows[2].TypeExpr)
+}
+
+func TestParseDocBlocks(t *testing.T) {
+	const yaml = `## @enum {string} Size - Size
+## preset
+## @value small
+
+## @param {Size} size - Size of
+## the instance
+## @maximum 3
+##
+## Example:
+##
+##
+##     size: small
+size: small
+## Not documentation: a value line ended the block
+## @param {int} plain - Plain
+##
+# single-hash comments are ignored
+## @section Other
+## Not documentation either
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	require.Equal(t, "Size preset", rows[0].Description)
+	require.Equal(t, "Size of the instance", rows[1].Description)
+	require.Equal(t, "Example:\n\n    size: small", rows[1].Doc)
+	require.Equal(t, 3.0, *rows[1].Maximum)
+	require.Equal(t, "Plain", rows[2].Description)
+	require.Empty(t, rows[2].Doc)
+
+	code, _, err := NewGen("values", "g", "v1").Generate(Build(rows))
+	require.NoError(t, err)
+	require.Contains(t, string(code), "// Size of the instance\n\t//\n\t// Example:\n\t//\n\t//     size: small\n")
+}
+
+func TestParseExamples(t *testing.T) {
+	const yaml = `## @param {map[string]int} ports - Ports
+## @example {"http": 80}
+## @example
+##   https: 443
+##   extra:
+##     nested: 1
+##
+## A blank line ends the block.
+## @minimum 1
+ports: {}
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	require.Equal(t, "Ports", rows[0].Description)
+	require.Equal(t, "A blank line ends the block.", rows[0].Doc)
+	require.Equal(t, 1.0, *rows[0].Minimum)
+	require.Len(t, rows[0].Examples, 2)
+	require.Equal(t, `{"http": 80}`, rows[0].Examples[0].Value)
+	require.Equal(t, "2:13", strings.TrimPrefix(rows[0].Examples[0].Pos.String(), tmp+":"))
+	require.Equal(t, "https: 443\nextra:\n  nested: 1", rows[0].Examples[1].Value)
+	require.Equal(t, "4:6", strings.TrimPrefix(rows[0].Examples[1].Pos.String(), tmp+":"))
+
+	code, _, err := NewGen("values", "g", "v1").Generate(Build(rows))
+	require.NoError(t, err)
+	require.Contains(t, string(code), `// +kubebuilder:example={"http":80}`)
+}
+
+func TestParseDottedParams(t *testing.T) {
+	const yaml = `## @param {string} postgres.version - Version
+## @param {int} [backups[].retention]=7 - Retention
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	require.Equal(t, []string{"postgres", "version"}, rows[0].Path)
+	require.Equal(t, []string{"backups[]", "retention"}, rows[1].Path)
+	require.True(t, rows[1].OmitEmpty)
+	require.Equal(t, "7", rows[1].DefaultVal)
+}
+
+func TestParseRejectsDottedParamsWithoutFields(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"scalar parent", "## @param {string} db - Db\n## @param {int} db.port - Port\n", "2:17: db is declared as {string} at"},
+		{"not a list", "## @typedef {struct} Job - Job\n## @field {string} name - Name\n## @param {Job} jobs - Jobs\n## @param {int} jobs[].retries - Retries\n", "4:17: jobs is declared as {Job} at"},
+		{"map parent", "## @param {map[string]string} labels - Labels\n## @param {string} labels.app - App\n", "which has no fields"},
+		{"enum parent", "## @enum {string} Size - Size\n## @value small\n## @param {Size} size - Size\n## @param {int} size.x - X\n", "which has no fields"},
+		{"scalar field", "## @typedef {struct} Db - Db\n## @field {string} host - Host\n## @field {int} host.port - Port\n", "3:17: Db.host is declared as {string} at"},
+		{"field not a list", "## @typedef {struct} Db - Db\n## @field {struct} backup - Backup\n## @field {int} backup[].retries - Retries\n", "3:17: Db.backup is declared as {struct} at"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := writeTempFile(tt.yaml)
+			defer os.Remove(tmp)
+			_, err := Parse(tmp)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestBuildDottedParams(t *testing.T) {
+	const yaml = `## @typedef {struct} Resources - Resources
+## @field {quantity} cpu - CPU
+
+## @param {bool} enabled - Enabled
+## @param {string} postgres.persistence.size - Size
+## @param {quantity} postgres.resources.memory - Memory
+## @param {Resources} postgres.resources - Resources
+## @param {string} backups[].name - Name
+## @param {Backup} restore - Restore
+## @param {string} restore.from - From
+## @param {int} Postgres.x - Clashes with the synthesized type
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	root := Build(rows)
+
+	require.Equal(t, []string{"enabled", "postgres", "backups", "restore", "Postgres"}, sortedKeysByOrder(paramsOf(root)))
+
+	pg := root.Child["postgres"]
+	require.True(t, pg.Implicit)
+	require.True(t, pg.OmitEmpty)
+	require.Equal(t, "PostgresValues", pg.TypeExpr)
+	typ := root.Child["PostgresValues"]
+	require.True(t, typ.Implicit)
+	require.Equal(t, "PostgresPersistence", typ.Child["persistence"].TypeExpr)
+	require.Equal(t, "PostgresValuesValues", root.Child["Postgres"].TypeExpr)
+	require.Equal(t, "Resources", typ.Child["resources"].TypeExpr)
+	require.False(t, typ.Child["resources"].Implicit)
+
+	// Dotted params extend declared typedefs
+	require.Contains(t, root.Child["Resources"].Child, "memory")
+	require.Contains(t, root.Child["Resources"].Child, "cpu")
+	require.Contains(t, root.Child["Backup"].Child, "from")
+
+	require.Equal(t, "[]BackupsItem", root.Child["backups"].TypeExpr)
+	require.Equal(t, "string", root.Child["BackupsItem"].Child["name"].TypeExpr)
+
+	_, _, err = NewGen("values", "g", "v1").Generate(root)
+	require.NoError(t, err)
+}
+
+// paramsOf returns the top-level params of root.
+func paramsOf(root *Node) map[string]*Node {
+	out := map[string]*Node{}
+	for k, n := range root.Child {
+		if n.IsParam {
+			out[k] = n
+		}
+	}
+	return out
+}
+
+func TestParseQuotedNames(t *testing.T) {
+	const yaml = `## @param {bool} "cert-manager" - Cert manager
+## @param {string} labels."app.kubernetes.io/name" - App name
+## @typedef {struct} Vault - Vault
+## @field {string} ["1password"] - 1Password item
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, []string{"cert-manager"}, rows[0].Path)
+	require.Equal(t, []string{"labels", "app.kubernetes.io/name"}, rows[1].Path)
+	require.Equal(t, []string{"Vault", "1password"}, rows[3].Path)
+	require.True(t, rows[3].OmitEmpty)
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"cert-manager":           "CertManager",
+		"app.kubernetes.io/name": "AppKubernetesIoName",
+		"1password":              "X1password",
+		"type":                   "Type",
+		"_":                      "X",
+		"ümlaut":                 "Ümlaut",
+	}
+	for in, want := range tests {
+		require.Equal(t, want, goName(in), in)
+	}
+}
+
+func TestGoNameCollisions(t *testing.T) {
+	const yaml = `## @typedef {struct} myDb - Snake
+## @field {string} host - Host
+## @typedef {struct} MyDb - Camel
+## @field {int} "max-conns" - Dashed
+## @field {int} maxConns - Camel
+## @enum {string} my_db - Enum
+## @value a
+
+## @param {bool} "cert-manager" - Dashed
+## @param {bool} certManager - Camel
+## @param {myDb} primary - Primary
+## @param {MyDb} replica - Replica
+## @param {my_db} mode - Mode
+## @param {string} config - Clashes with the root type
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		code, _, err := NewGen("values", "g", "v1").Generate(Build(rows))
+		require.NoError(t, err)
+		src := string(code)
+		require.Contains(t, src, "CertManager bool `json:\"cert-manager\"`")
+		require.Contains(t, src, "CertManager2 bool `json:\"certManager\"`")
+		require.Contains(t, src, "Config string `json:\"config\"`")
+		require.Contains(t, src, "Primary MyDb2 `json:\"primary\"`")
+		require.Contains(t, src, "Replica MyDb `json:\"replica\"`")
+		require.Contains(t, src, "Mode MyDb3 `json:\"mode\"`")
+		require.Contains(t, src, "type MyDb3 string")
+		require.Contains(t, src, "MaxConns int `json:\"max-conns\"`")
+		require.Contains(t, src, "MaxConns2 int `json:\"maxConns\"`")
+	}
+}
+
+func TestParseRequired(t *testing.T) {
+	const yaml = `## @param {string} name - Name
+## @required
+## @param {int} replicas - Replicas
+## @param {[]string} [tags] - Tags
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.True(t, rows[0].Required)
+	require.False(t, rows[1].Required)
+	require.False(t, rows[1].OmitEmpty)
+
+	rows, err = ParseWithOptions(tmp, ParseOptions{OptionalByDefault: true})
+	require.NoError(t, err)
+	require.False(t, rows[0].OmitEmpty)
+	require.True(t, rows[1].OmitEmpty)
+	require.True(t, rows[2].OmitEmpty)
+
+	root := Build(rows)
+	code, _, err := NewGen("values", "g", "v1").Generate(root)
+	require.NoError(t, err)
+	require.Contains(t, string(code), "// +required\n\tName string `json:\"name\"`")
+	require.Contains(t, string(code), "// +optional\n\tReplicas int `json:\"replicas,omitempty\"`")
+}
+
+func TestParseRejectsRequiredOptional(t *testing.T) {
+	tmp := writeTempFile("## @param {string} [name] - Name\n## @required\n")
+	defer os.Remove(tmp)
+
+	_, err := Parse(tmp)
+	require.ErrorContains(t, err, `2:4: "name" is declared optional with [name] and cannot be @required`)
+}
+
+func TestParseValidate(t *testing.T) {
+	const yaml = `## @typedef {struct} Quorum - Quorum
+## @validate self.min <= self.max - min must not exceed max
+## @field {int} min - Min
+## @field {int} max - Max
+## @validate self >= 0
+
+## @param {Quorum} quorum - Quorum
+## @validate self.max - self.min < 3 - at most 2 optional replicas
+`
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Equal(t, []Validation{{Rule: "self.min <= self.max", Message: "min must not exceed max", Pos: rows[0].Validations[0].Pos}}, rows[0].Validations)
+	require.Equal(t, "2:14", strings.TrimPrefix(rows[0].Validations[0].Pos.String(), tmp+":"))
+	require.Empty(t, rows[1].Validations)
+	require.Equal(t, "self >= 0", rows[2].Validations[0].Rule)
+	require.Empty(t, rows[2].Validations[0].Message)
+	require.Equal(t, "self.max - self.min < 3", rows[3].Validations[0].Rule)
+	require.Equal(t, "at most 2 optional replicas", rows[3].Validations[0].Message)
+
+	tmp2 := writeTempFile("## @enum {string} Size - Size\n## @validate self != ''\n")
+	defer os.Remove(tmp2)
+	_, err = Parse(tmp2)
+	require.ErrorContains(t, err, "2:4: @validate must follow a @param, @field or @typedef")
+}
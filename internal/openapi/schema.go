@@ -0,0 +1,393 @@
+package openapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/version"
+	apiextv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-tools/pkg/crd"
+	crdmarkers "sigs.k8s.io/controller-tools/pkg/crd/markers"
+	"sigs.k8s.io/controller-tools/pkg/markers"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  Native schema generator                                                    */
+/* -------------------------------------------------------------------------- */
+
+// The native generator walks the Node tree directly and produces the same
+// OpenAPI v3 schema controller-gen derives from the generated Go structs.
+// Markers are rendered by gen.fieldMarkers and parsed with the controller-tools
+// marker registry, so their semantics stay identical; no Go package is loaded
+// and no go toolchain is required.
+
+// quantityPattern is the validation pattern controller-gen attaches to resource.Quantity.
+const quantityPattern = "^(\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\\+|-)?(([0-9]+(\\.[0-9]*)?)|(\\.[0-9]+))))?$"
+
+type schemaBuilder struct {
+	g        *gen
+	reg      *markers.Registry
+	types    map[string]*Node // Go type name → defining node
+	cache    map[string]apiextv1.JSONSchemaProps
+	visiting map[string]bool
+	errs     []error
+}
+
+func newSchemaBuilder(root *Node) (*schemaBuilder, error) {
+	reg := &markers.Registry{}
+	if err := crdmarkers.Register(reg); err != nil {
+		return nil, fmt.Errorf("register markers: %w", err)
+	}
+	g := &gen{}
+	g.collectDefined(root)
+
+	b := &schemaBuilder{
+		g:        g,
+		reg:      reg,
+		types:    map[string]*Node{},
+		cache:    map[string]apiextv1.JSONSchemaProps{},
+		visiting: map[string]bool{},
+	}
+	for _, k := range sortedKeys(root.Child) {
+		if c := root.Child[k]; isTypeNode(c) {
+			b.types[g.typeName(c.Name)] = c
+		}
+	}
+	return b, nil
+}
+
+// AddError implements crd.ErrorRecorder for schema flattening.
+func (b *schemaBuilder) AddError(err error) { b.errs = append(b.errs, err) }
+
+// docString mirrors how controller-gen turns a Go doc comment into a description.
+func docString(comment string) string {
+	var out []string
+	inCode := false
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		if strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~") {
+			inCode = !inCode
+		}
+		if !inCode {
+			if strings.HasPrefix(line, "TODO") {
+				continue
+			}
+			if strings.HasPrefix(line, "---") {
+				break
+			}
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// isExternalType reports whether goType is a package-qualified type, which
+// controller-gen references via $ref and flattens later. Local types are
+// inlined by the controller-tools fork we depend on.
+func isExternalType(goType string) bool {
+	t := strings.TrimPrefix(goType, "*")
+	if strings.HasPrefix(t, "[]") || strings.HasPrefix(t, "map[") {
+		return false
+	}
+	return strings.Contains(t, ".")
+}
+
+func builtinSchema(t string) (apiextv1.JSONSchemaProps, bool) {
+	switch t {
+	case "string":
+		return apiextv1.JSONSchemaProps{Type: "string"}, true
+	case "bool":
+		return apiextv1.JSONSchemaProps{Type: "boolean"}, true
+	case "int", "int8", "int16", "uint", "uint8", "uint16":
+		return apiextv1.JSONSchemaProps{Type: "integer"}, true
+	case "int32", "uint32":
+		return apiextv1.JSONSchemaProps{Type: "integer", Format: "int32"}, true
+	case "int64", "uint64":
+		return apiextv1.JSONSchemaProps{Type: "integer", Format: "int64"}, true
+	case "float32", "float64":
+		return apiextv1.JSONSchemaProps{Type: "number"}, true
+	}
+	return apiextv1.JSONSchemaProps{}, false
+}
+
+// typeSchema returns the schema for a Go type expression as emitted by gen.
+func (b *schemaBuilder) typeSchema(goType string) (apiextv1.JSONSchemaProps, error) {
+	t := strings.TrimPrefix(strings.TrimSpace(goType), "*")
+
+	if strings.HasPrefix(t, "[]") {
+		items, err := b.typeSchema(t[2:])
+		if err != nil {
+			return apiextv1.JSONSchemaProps{}, err
+		}
+		return apiextv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &apiextv1.JSONSchemaPropsOrArray{Schema: &items},
+		}, nil
+	}
+	if strings.HasPrefix(t, "map[") && strings.Contains(t, "]") {
+		val, err := b.typeSchema(t[strings.Index(t, "]")+1:])
+		if err != nil {
+			return apiextv1.JSONSchemaProps{}, err
+		}
+		return apiextv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &apiextv1.JSONSchemaPropsOrBool{Allows: true, Schema: &val},
+		}, nil
+	}
+	if s, ok := builtinSchema(t); ok {
+		return s, nil
+	}
+
+	switch t {
+	case "resource.Quantity":
+		return apiextv1.JSONSchemaProps{
+			XIntOrString: true,
+			AnyOf:        []apiextv1.JSONSchemaProps{{Type: "integer"}, {Type: "string"}},
+			Pattern:      quantityPattern,
+		}, nil
+	case "intstr.IntOrString":
+		return apiextv1.JSONSchemaProps{
+			XIntOrString: true,
+			AnyOf:        []apiextv1.JSONSchemaProps{{Type: "integer"}, {Type: "string"}},
+		}, nil
+	case "apiextensionsv1.JSON":
+		return apiextv1.JSONSchemaProps{XPreserveUnknownFields: ptr.To(true)}, nil
+	case "metav1.Duration":
+		return apiextv1.JSONSchemaProps{Type: "string"}, nil
+	case "metav1.Time":
+		return apiextv1.JSONSchemaProps{Type: "string", Format: "date-time"}, nil
+	case "k8sRuntime.RawExtension":
+		return apiextv1.JSONSchemaProps{Type: "object", XPreserveUnknownFields: ptr.To(true)}, nil
+	}
+
+	if s, ok := b.cache[t]; ok {
+		return *s.DeepCopy(), nil
+	}
+	n, ok := b.types[t]
+	if !ok {
+		return apiextv1.JSONSchemaProps{}, fmt.Errorf("unsupported type %q", t)
+	}
+	if b.visiting[t] {
+		return apiextv1.JSONSchemaProps{}, fmt.Errorf("recursive type %q", t)
+	}
+	b.visiting[t] = true
+	defer delete(b.visiting, t)
+
+	var (
+		s   apiextv1.JSONSchemaProps
+		err error
+	)
+	if len(n.Enums) > 0 {
+		base := n.TypeExpr
+		if base == "" {
+			base = "string"
+		}
+		if s, err = b.typeSchema(base); err != nil {
+			return apiextv1.JSONSchemaProps{}, err
+		}
+		b.applyMarkers(&s, []string{"+kubebuilder:validation:Enum=" + quoteEnums(n.Enums)}, markers.DescribesType)
+	} else if n.IsAlias() {
+		if s, err = b.aliasSchema(n); err != nil {
+			return apiextv1.JSONSchemaProps{}, err
+		}
+	} else if s, err = b.structSchema(n, false); err != nil {
+		return apiextv1.JSONSchemaProps{}, err
+	}
+	b.cache[t] = s
+	return *s.DeepCopy(), nil
+}
+
+// structSchema builds the object schema for n; params selects the top-level
+// ConfigSpec view (only @param children) instead of a typedef. The schemas
+// of base types are merged in the way controller-gen flattens inline
+// embedded structs.
+func (b *schemaBuilder) structSchema(n *Node, params bool) (apiextv1.JSONSchemaProps, error) {
+	s := apiextv1.JSONSchemaProps{
+		Type:       "object",
+		Properties: map[string]apiextv1.JSONSchemaProps{},
+	}
+	for _, k := range sortedKeys(n.Child) {
+		c := n.Child[k]
+		if (params && !c.IsParam) || inherited(n, c) {
+			continue
+		}
+		typ := b.g.goType(c)
+		prop, err := b.fieldSchema(c, typ)
+		if err != nil {
+			return apiextv1.JSONSchemaProps{}, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		if c.IsRequired() {
+			s.Required = append(s.Required, c.Name)
+		}
+		s.Properties[c.Name] = prop
+	}
+	sort.Strings(s.Required)
+	b.applyMarkers(&s, typeMarkers(n, params), markers.DescribesType)
+	if len(n.Embeds) == 0 {
+		return s, nil
+	}
+	for _, e := range n.Embeds {
+		base, err := b.typeSchema(b.g.typeName(e.Type))
+		if err != nil {
+			return apiextv1.JSONSchemaProps{}, err
+		}
+		s.AllOf = append(s.AllOf, base)
+	}
+	return *crd.FlattenEmbedded(&s, b), nil
+}
+
+// aliasSchema builds the schema of the named type of an alias: the schema of
+// the type it names with the markers of the alias on top, merged the way
+// controller-gen merges the markers of a field into a referenced type.
+func (b *schemaBuilder) aliasSchema(n *Node) (apiextv1.JSONSchemaProps, error) {
+	typ := b.g.goType(n)
+	base, err := b.typeSchema(typ)
+	if err != nil {
+		return apiextv1.JSONSchemaProps{}, err
+	}
+	if !isExternalType(typ) {
+		b.applyMarkers(&base, b.g.aliasMarkers(n), markers.DescribesType)
+		return base, nil
+	}
+	var own apiextv1.JSONSchemaProps
+	b.applyMarkers(&own, b.g.aliasMarkers(n), markers.DescribesType)
+	out := apiextv1.JSONSchemaProps{AllOf: []apiextv1.JSONSchemaProps{base, own}}
+	return *crd.FlattenEmbedded(&out, b), nil
+}
+
+func (b *schemaBuilder) fieldSchema(c *Node, typ string) (apiextv1.JSONSchemaProps, error) {
+	base, err := b.typeSchema(typ)
+	if err != nil {
+		return apiextv1.JSONSchemaProps{}, err
+	}
+	desc := docString(c.Documentation())
+	fieldMarkers := b.g.fieldMarkers(c, typ)
+
+	if !isExternalType(typ) {
+		if desc != "" {
+			base.Description = desc
+		}
+		b.applyMarkers(&base, fieldMarkers, markers.DescribesField)
+		return base, nil
+	}
+
+	// External types are references in controller-gen: field markers apply
+	// to an empty schema which is then merged with the referenced type.
+	var field apiextv1.JSONSchemaProps
+	b.applyMarkers(&field, fieldMarkers, markers.DescribesField)
+	out := apiextv1.JSONSchemaProps{
+		AllOf:       []apiextv1.JSONSchemaProps{base, field},
+		Description: base.Description,
+	}
+	if desc != "" {
+		out.Description = desc
+	}
+	return *crd.FlattenEmbedded(&out, b), nil
+}
+
+// applyMarkers parses raw marker strings and applies them in controller-gen
+// priority order. Markers which fail to parse or apply are skipped, exactly
+// as controller-gen drops them.
+func (b *schemaBuilder) applyMarkers(s *apiextv1.JSONSchemaProps, raw []string, target markers.TargetType) {
+	var vals []crd.SchemaMarker
+	for _, m := range raw {
+		def := b.reg.Lookup(m, target)
+		if def == nil {
+			continue
+		}
+		v, err := def.Parse(m)
+		if err != nil {
+			continue
+		}
+		if sm, ok := v.(crd.SchemaMarker); ok {
+			vals = append(vals, sm)
+		}
+	}
+	priority := func(m crd.SchemaMarker) crdmarkers.ApplyPriority {
+		if pm, ok := m.(crdmarkers.ApplyPriorityMarker); ok {
+			return pm.ApplyPriority()
+		}
+		return crdmarkers.ApplyPriorityDefault
+	}
+	sort.SliceStable(vals, func(i, j int) bool { return priority(vals[i]) < priority(vals[j]) })
+	for _, v := range vals {
+		_ = v.ApplyToSchema(s)
+	}
+}
+
+// BuildSchema returns the OpenAPI v3 schema of the ConfigSpec generated for root.
+func BuildSchema(root *Node) (*apiextv1.JSONSchemaProps, error) {
+	if err := undefinedError(root); err != nil {
+		return nil, err
+	}
+	if err := embedError(root); err != nil {
+		return nil, err
+	}
+	b, err := newSchemaBuilder(root)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := b.structSchema(root, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.errs) > 0 {
+		return nil, fmt.Errorf("flatten schema: %v", b.errs[0])
+	}
+	return &spec, nil
+}
+
+// GenerateCRD renders the CRD for root in the same shape as CG, without
+// writing Go sources or invoking controller-gen.
+func GenerateCRD(root *Node, groupName, versionName string) ([]byte, error) {
+	spec, err := BuildSchema(root)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := apiextv1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextv1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "configs." + groupName,
+			Annotations: map[string]string{
+				"controller-gen.kubebuilder.io/version": version.Version,
+			},
+		},
+		Spec: apiextv1.CustomResourceDefinitionSpec{
+			Group: groupName,
+			Names: apiextv1.CustomResourceDefinitionNames{
+				Kind:     "Config",
+				ListKind: "ConfigList",
+				Plural:   "configs",
+				Singular: "config",
+			},
+			Scope: apiextv1.NamespaceScoped,
+			Versions: []apiextv1.CustomResourceDefinitionVersion{{
+				Name:    versionName,
+				Served:  true,
+				Storage: true,
+				Schema: &apiextv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextv1.JSONSchemaProps{
+							"metadata": {Type: "object"},
+							"spec":     *spec,
+						},
+					},
+				},
+			}},
+		},
+	}
+
+	return sigyaml.Marshal(&obj)
+}
@@ -0,0 +1,692 @@
+package openapi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// legacyAndNativeCRD renders the CRD for a values file through both the
+// controller-gen pipeline and the native generator.
+func legacyAndNativeCRD(t *testing.T, path string) (legacy, native []byte) {
+	t.Helper()
+	return legacyAndNativeCRDWithOptions(t, path, ParseOptions{})
+}
+
+// legacyAndNativeCRDWithOptions is legacyAndNativeCRD with parse options.
+func legacyAndNativeCRDWithOptions(t *testing.T, path string, opts ParseOptions) (legacy, native []byte) {
+	t.Helper()
+	rows, err := ParseWithOptions(path, opts)
+	require.NoError(t, err)
+	root := Build(rows)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var values map[string]interface{}
+	require.NoError(t, sigyaml.Unmarshal(raw, &values))
+	PopulateDefaults(root, values, root.Child)
+
+	tmpdir, goFile, err := WriteGeneratedGoAndStub(root, "values", "values.helm.io", "v1alpha1")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmpdir)
+	legacy, err = CG(filepath.Dir(goFile))
+	require.NoError(t, err)
+
+	native, err = GenerateCRD(root, "values.helm.io", "v1alpha1")
+	require.NoError(t, err)
+	return legacy, native
+}
+
+// nativeSchema renders the values file yaml through both pipelines, requires
+// the same CRD from each and returns it with the values.schema.json document
+// built from it.
+func nativeSchema(t *testing.T, yaml string) (crd string, schema map[string]interface{}) {
+	t.Helper()
+	return nativeSchemaWithOptions(t, yaml, ParseOptions{})
+}
+
+// nativeSchemaWithOptions is nativeSchema with parse options.
+func nativeSchemaWithOptions(t *testing.T, yaml string, opts ParseOptions) (crd string, schema map[string]interface{}) {
+	t.Helper()
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+	legacy, native := legacyAndNativeCRDWithOptions(t, tmp, opts)
+	require.Equal(t, string(legacy), string(native))
+
+	rows, err := ParseWithOptions(tmp, opts)
+	require.NoError(t, err)
+	out, err := ValuesSchema(native, Build(rows))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(out, &schema))
+	return string(native), schema
+}
+
+// goTypes returns the Go types generated for the values file yaml.
+func goTypes(t *testing.T, yaml string) string {
+	t.Helper()
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	src, _, err := NewGen("values", "g", "v1").Generate(Build(rows))
+	require.NoError(t, err)
+	return string(src)
+}
+
+// lookup returns the value of the JSON document v at path, a list of object
+// keys and array indexes, or nil.
+func lookup(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch k := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[k]
+		case int:
+			a, _ := v.([]interface{})
+			if k >= len(a) {
+				return nil
+			}
+			v = a[k]
+		}
+	}
+	return v
+}
+
+// TestNativeSchemaMatchesControllerGen checks that the native generator is
+// byte-for-byte equivalent to controller-gen on every example.
+func TestNativeSchemaMatchesControllerGen(t *testing.T) {
+	examplesDir := "../../examples"
+	files, err := os.ReadDir(examplesDir)
+	require.NoError(t, err)
+
+	for _, file := range files {
+		if filepath.Ext(file.Name()) != ".yaml" {
+			continue
+		}
+		t.Run(file.Name(), func(t *testing.T) {
+			legacy, native := legacyAndNativeCRD(t, filepath.Join(examplesDir, file.Name()))
+			require.Equal(t, string(legacy), string(native))
+		})
+	}
+}
+
+func TestNativeSchemaEdgeCases(t *testing.T) {
+	const yaml = `
+## @enum {int32} Level - Level
+## @value 1
+## @value 2
+
+## @typedef {struct} Config - Name clashing with the root kind
+## @field {[]Level} levels - Levels
+## @field {map[string]*quantity} limits - Limits
+
+## @typedef {struct} Empty
+
+## @param {Config} config - Clashing config
+## @param {*Empty} [empty] - Empty struct
+## @param {Level} level=2 - Level with default
+## @minimum 1
+## @param {int64} big - Big number
+## @exclusiveMaximum
+## @maximum 10
+## @param {[]uri} links - Links
+## @minItems 1
+## @param {password} secret - TODO: hide this
+## @minLength 8
+## @param {float32} ratio=0.5 - Ratio
+config:
+  levels: [1]
+big: 1
+links: []
+secret: ""
+`
+	nativeSchema(t, yaml)
+}
+
+// TestNativeSchemaTimeAndDuration checks the documented mapping for time and
+// duration, which the controller-gen path leaves untyped.
+func TestNativeSchemaTimeAndDuration(t *testing.T) {
+	rows := []Raw{
+		{K: kParam, Path: []string{"since"}, TypeExpr: "time"},
+		{K: kParam, Path: []string{"every"}, TypeExpr: "*duration", DefaultVal: "5m"},
+	}
+	spec, err := BuildSchema(Build(rows))
+	require.NoError(t, err)
+
+	since := spec.Properties["since"]
+	require.Equal(t, "string", since.Type)
+	require.Equal(t, "date-time", since.Format)
+
+	every := spec.Properties["every"]
+	require.Equal(t, "string", every.Type)
+	require.Equal(t, `"5m"`, string(every.Default.Raw))
+	require.Equal(t, []string{"since"}, spec.Required)
+}
+
+func TestBuildSchemaUndefinedType(t *testing.T) {
+	rows := []Raw{
+		{K: kParam, Path: []string{"a"}, TypeExpr: "Missing"},
+	}
+	_, err := BuildSchema(Build(rows))
+	require.ErrorContains(t, err, "undefined types: Missing")
+}
+
+// TestNativeSchemaDocBlocks checks that multi-line documentation reaches the
+// schema exactly as controller-gen renders it from the Go doc comments.
+func TestNativeSchemaDocBlocks(t *testing.T) {
+	const yaml = `## @typedef {struct} Db - Database
+## @field {string} host - Host name
+##   or IP address
+##
+## TODO: this line is dropped
+## ` + "```yaml" + `
+## host: db.local
+## ---
+## TODO: kept inside the fence
+## ` + "```" + `
+## ---
+## Dropped after the separator.
+
+## @param {Db} db - Database
+## settings, see below
+## @minLength 1
+##
+## Details:
+##
+##
+##     indented block
+## @param {int} plain - No docs
+db:
+  host: x
+plain: 1
+`
+	crd, _ := nativeSchema(t, yaml)
+	require.Contains(t, crd, "Database settings, see below")
+	require.Contains(t, crd, "TODO: kept inside the fence")
+	require.NotContains(t, crd, "Dropped after the separator")
+}
+
+// TestNativeSchemaExamples checks that the first @example becomes the
+// OpenAPI example in both pipelines and that values.schema.json lists all of
+// them under examples.
+func TestNativeSchemaExamples(t *testing.T) {
+	const yaml = `## @typedef {struct} User - User
+## @field {string} password - Password
+## @example "secret"
+## @field {[]int} ports - Ports
+## @example [80, 443]
+
+## @param {map[string]User} users - Users
+## @example {"alice": {"password": "x"}}
+## @example
+##   bob:
+##     ports:
+##       - 8080
+## @param {float64} ratio - Ratio
+## @example 0.5
+users: {}
+ratio: 1.5
+`
+	_, schema := nativeSchema(t, yaml)
+	users := lookup(schema, "properties", "users")
+	require.Equal(t, map[string]interface{}{"alice": map[string]interface{}{"password": "x"}}, lookup(users, "example"))
+	require.Len(t, lookup(users, "examples"), 2)
+	require.Equal(t, map[string]interface{}{"bob": map[string]interface{}{"ports": []interface{}{float64(8080)}}}, lookup(users, "examples", 1))
+	require.Equal(t, []interface{}{"secret"}, lookup(users, "additionalProperties", "properties", "password", "examples"))
+	require.Equal(t, []interface{}{[]interface{}{float64(80), float64(443)}}, lookup(users, "additionalProperties", "properties", "ports", "examples"))
+	require.Equal(t, []interface{}{0.5}, lookup(schema, "properties", "ratio", "examples"))
+}
+
+func TestNativeSchemaDottedParams(t *testing.T) {
+	const yaml = `## @typedef {struct} Resources - Resources
+## @field {quantity} cpu - CPU
+
+## @param {string} postgres.version="16" - Version
+## @param {int} postgres.persistence.size - Size
+## @minimum 1
+## @param {Resources} postgres.resources - Resources
+## @param {quantity} postgres.resources.memory - Memory
+## @param {string} backups[].name - Name
+postgres:
+  persistence:
+    size: 10
+  resources:
+    cpu: 1
+backups:
+  - name: daily
+`
+	_, schema := nativeSchema(t, yaml)
+	require.Nil(t, lookup(schema, "required"), "objects synthesized for dotted params are optional")
+	pg := lookup(schema, "properties", "postgres")
+	require.Equal(t, []interface{}{"resources", "version"}, lookup(pg, "required"))
+	require.Equal(t, float64(1), lookup(pg, "properties", "persistence", "properties", "size", "minimum"))
+	require.NotNil(t, lookup(pg, "properties", "resources", "properties", "memory"))
+	require.NotNil(t, lookup(schema, "properties", "backups", "items", "properties", "name"))
+}
+
+func TestNativeSchemaQuotedNames(t *testing.T) {
+	const yaml = `## @typedef {struct} Vault - Vault
+## @field {string} ["1password"] - 1Password item
+## @field {string} "app.kubernetes.io/name" - App name
+
+## @param {bool} "cert-manager"=true - Cert manager
+## @param {bool} certManager - Camel-case twin
+## @param {Vault} vault - Vault
+## @param {string} labels."app.kubernetes.io/part-of" - Part of
+cert-manager: true
+certManager: false
+vault:
+  app.kubernetes.io/name: demo
+labels:
+  app.kubernetes.io/part-of: cozystack
+`
+	crd, _ := nativeSchema(t, yaml)
+	require.Contains(t, crd, "cert-manager:")
+	require.Contains(t, crd, "1password:")
+	require.Contains(t, crd, "app.kubernetes.io/part-of:")
+}
+
+func TestNativeSchemaRequired(t *testing.T) {
+	const yaml = `## @typedef {struct} Backup - Backup
+## @field {string} schedule - Schedule
+## @required
+## @field {string} [bucket] - Bucket
+## @field {[]string} targets - Targets
+## @required
+
+## @param {Backup} backup - Backup
+## @param {*int} replicas - Replicas
+## @required
+## @param {map[string]string} labels - Labels
+## @param {string} name - Name
+## @required
+backup:
+  schedule: "@daily"
+  targets: []
+replicas: 1
+name: x
+`
+	specRequired := func(crd string) interface{} {
+		var doc interface{}
+		require.NoError(t, sigyaml.Unmarshal([]byte(crd), &doc))
+		return lookup(doc, "spec", "versions", 0, "schema", "openAPIV3Schema", "properties", "spec", "required")
+	}
+
+	// values.schema.json lists @required params only, in declaration order,
+	// so partial overrides of values.yaml stay valid
+	crd, schema := nativeSchema(t, yaml)
+	require.Equal(t, []interface{}{"backup", "name", "replicas"}, specRequired(crd))
+	require.Equal(t, []interface{}{"replicas", "name"}, lookup(schema, "required"))
+	require.Equal(t, []interface{}{"schedule", "targets"}, lookup(schema, "properties", "backup", "required"))
+
+	// Nothing but @required is required by default
+	crd, schema = nativeSchemaWithOptions(t, yaml, ParseOptions{OptionalByDefault: true})
+	require.Equal(t, []interface{}{"name", "replicas"}, specRequired(crd))
+	require.Equal(t, []interface{}{"replicas", "name"}, lookup(schema, "required"))
+	require.Equal(t, []interface{}{"schedule", "targets"}, lookup(schema, "properties", "backup", "required"))
+}
+
+func TestNativeSchemaValidations(t *testing.T) {
+	const yaml = `## @typedef {struct} Quorum - Quorum
+## @validate self.min <= self.max - min must not exceed max
+## @field {int} min - Min
+## @field {int} max - Max
+## @validate self >= 0 && self < 10
+
+## @param {Quorum} quorum - Quorum
+## @validate self.max - self.min < 3 - at most 2 "optional" replicas
+## @param {[]Quorum} [extra] - More quorums
+## @param {string} storageClass - Storage class
+## @validate self != ''
+quorum:
+  min: 0
+  max: 1
+storageClass: local
+`
+	crd, _ := nativeSchema(t, yaml)
+	require.Contains(t, crd, `rule: self.min <= self.max`)
+	require.Contains(t, crd, `message: at most 2 "optional" replicas`)
+}
+
+func TestNativeSchemaImmutable(t *testing.T) {
+	const yaml = `## @typedef {struct} Disk - Disk
+## @field {string} image - Image
+## @immutable
+## @field {string} [storageClass] - Storage class
+## @immutable
+
+## @param {Disk} disk - Disk
+## @param {string} name - Name
+## @immutable
+disk:
+  image: ubuntu
+name: vm
+`
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, "message: storageClass is immutable\n                      rule: self == oldSelf")
+	require.Equal(t, true, lookup(schema, "properties", "name", "x-immutable"))
+	require.Nil(t, lookup(schema, "properties", "disk", "x-immutable"))
+	require.Equal(t, true, lookup(schema, "properties", "disk", "properties", "image", "x-immutable"))
+	require.Equal(t, true, lookup(schema, "properties", "disk", "properties", "storageClass", "x-immutable"))
+}
+
+func TestNativeSchemaConditions(t *testing.T) {
+	const yaml = `## @enum {string} Provider - Provider
+## @value s3
+## @value gcs
+
+## @typedef {struct} Backup - Backup
+## @field {bool} enabled - Enable backups
+## @field {Provider} provider - Provider
+## @field {string} [s3Bucket] - S3 bucket
+## @requiredIf provider=s3
+## @field {float64} [ratio] - Ratio
+## @requiredIf key-name=1.5
+## @field {float64} "key-name" - Key
+
+## @param {bool} external - External access
+## @param {[]int} externalPorts - Ports
+## @requiredIf external=true
+## @visibleIf external=true
+## @param {Backup} backup - Backup
+## @param {string} [schedule] - Schedule
+## @requiredIf backup.enabled=true
+external: false
+externalPorts: []
+backup:
+  enabled: false
+  provider: s3
+  s3Bucket: bucket
+  key-name: 1
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, `rule: '!(has(self.backup) && has(self.backup.enabled) && self.backup.enabled`)
+	require.Contains(t, crd, `rule: '!(has(self.provider) && self.provider == "s3") || (has(self.s3Bucket)`)
+
+	allOf := lookup(schema, "allOf")
+	require.Len(t, allOf, 2)
+	require.Equal(t, map[string]interface{}{
+		"properties": map[string]interface{}{"external": map[string]interface{}{"const": true}},
+		"required":   []interface{}{"external"},
+	}, lookup(allOf, 0, "if"))
+	require.Equal(t, map[string]interface{}{
+		"properties": map[string]interface{}{"externalPorts": map[string]interface{}{"minItems": float64(1)}},
+		"required":   []interface{}{"externalPorts"},
+	}, lookup(allOf, 0, "then"))
+	require.Equal(t, map[string]interface{}{"required": []interface{}{"schedule"}, "properties": map[string]interface{}{"schedule": map[string]interface{}{"minLength": float64(1)}}}, lookup(allOf, 1, "then"))
+	require.Equal(t, map[string]interface{}{"external": true}, lookup(schema, "properties", "externalPorts", "x-visible-if"))
+	require.Len(t, lookup(schema, "properties", "backup", "allOf"), 2)
+	require.Equal(t, map[string]interface{}{"required": []interface{}{"ratio"}}, lookup(schema, "properties", "backup", "allOf", 0, "then"))
+}
+
+func TestNativeSchemaMapKeys(t *testing.T) {
+	const yaml = `## @enum {string} Size - Size
+## @value small
+## @value large
+
+## @typedef {struct} User - User
+## @field {string} password - Password
+## @field {map[string]int} [quotas] - Quotas
+## @keyPattern ^[a-z]+$
+## @maxProperties 3
+
+## @param {map[string]User} users - Users
+## @keyPattern ^[a-z0-9]([-a-z0-9]*[a-z0-9])?$
+## @minProperties 1
+## @param {map[Size]string} presets - Presets
+users:
+  alice:
+    password: x
+presets:
+  small: a
+`
+	require.Empty(t, checkYAML(t, yaml))
+	require.Contains(t, goTypes(t, yaml), "Presets map[Size]string `json:\"presets,omitempty\"`")
+
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, `rule: self.all(k, k in ["small", "large"])`)
+	require.Contains(t, crd, "minProperties: 1")
+
+	users := lookup(schema, "properties", "users")
+	require.Equal(t, map[string]interface{}{"pattern": "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"}, lookup(users, "propertyNames"))
+	require.Equal(t, map[string]interface{}{"pattern": "^[a-z]+$"}, lookup(users, "additionalProperties", "properties", "quotas", "propertyNames"))
+	require.Equal(t, map[string]interface{}{"enum": []interface{}{"small", "large"}}, lookup(schema, "properties", "presets", "propertyNames"))
+}
+
+func TestNativeSchemaListTypes(t *testing.T) {
+	const yaml = `## @typedef {struct} Port - Port
+## @field {string} protocol="TCP" - Protocol
+## @field {int} port - Port
+## @field {string} [name] - Name
+## @immutable
+
+## @param {[]Port} ports - Ports
+## @listMapKey port
+## @listMapKey protocol
+## @param {[]string} sshKeys - SSH keys
+## @uniqueItems
+## @param {[]string} args - Arguments
+## @listType atomic
+ports:
+  - port: 80
+sshKeys: []
+args: []
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, "x-kubernetes-list-map-keys:\n                - port\n                - protocol\n                x-kubernetes-list-type: map")
+	require.Contains(t, crd, "x-kubernetes-list-type: atomic")
+	require.Equal(t, true, lookup(schema, "properties", "sshKeys", "uniqueItems"))
+	require.Nil(t, lookup(schema, "properties", "ports", "uniqueItems"))
+}
+
+func TestNativeSchemaUnions(t *testing.T) {
+	const yaml = `## @typedef {struct} Port - Port
+## @field {intOrString} targetPort=8080 - Target port
+## @field {int32 | string} [nodePort] - Node port
+
+## @param {[]Port} ports - Ports
+## @param {bool|string} [tls] - TLS: true, false or the name of a secret
+## @param {map[string]float64|bool} [limits] - Limits
+ports:
+  - targetPort: http
+tls: my-cert
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, "targetPort:\n                      anyOf:\n                      - type: integer\n                      - type: string\n                      default: 8080")
+	require.Contains(t, crd, "tls:\n                default: my-cert\n                description: 'TLS: true, false or the name of a secret'\n                x-kubernetes-preserve-unknown-fields: true")
+	require.Equal(t, []interface{}{map[string]interface{}{"type": "boolean"}, map[string]interface{}{"type": "string"}}, lookup(schema, "properties", "tls", "anyOf"))
+	require.Equal(t, []interface{}{map[string]interface{}{"type": "boolean"}, map[string]interface{}{"type": "number"}}, lookup(schema, "properties", "limits", "additionalProperties", "anyOf"))
+
+	src := goTypes(t, yaml)
+	require.Contains(t, src, "TargetPort intstr.IntOrString")
+	require.Contains(t, src, "Tls apiextensionsv1.JSON `json:\"tls,omitempty\"`")
+}
+
+func TestNativeSchemaUnionTypedef(t *testing.T) {
+	const yaml = `## @typedef {struct} S3Target - S3 bucket
+## @field {string} bucket - Bucket name
+## @typedef {struct} GCSTarget - GCS bucket
+## @field {string} bucket - Bucket name
+## @field {string} [project] - Project
+
+## @union {BackupTarget} - Backup target discriminator=kind
+## @variant s3 S3Target
+## @variant gcs GCSTarget - Google Cloud Storage
+## @field {string} [prefix] - Key prefix
+
+## @param {BackupTarget} target - Where backups go
+target:
+  kind: s3
+  s3:
+    bucket: backups
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	crd, schema := nativeSchema(t, yaml)
+	require.Contains(t, crd, "default:\n                  kind: s3\n                  s3:\n                    bucket: backups\n")
+	require.Contains(t, crd, "- message: exactly the member named by kind must be set\n")
+
+	src := goTypes(t, yaml)
+	require.Contains(t, src, "// +union\n// +kubebuilder:validation:XValidation:rule=\"has(self.s3) == (self.kind == \\\"s3\\\") && has(self.gcs) == (self.kind == \\\"gcs\\\")\",message=\"exactly the member named by kind must be set\"\ntype BackupTarget struct {\n")
+	require.Contains(t, src, "\t// Selects the variant\n\t// +required\n\t// +unionDiscriminator\n\tKind BackupTargetKind `json:\"kind\"`\n")
+	require.Contains(t, src, "\t// Google Cloud Storage\n\t// +optional\n\tGcs *GCSTarget `json:\"gcs,omitempty\"`\n")
+
+	oneOf := lookup(schema, "properties", "target", "oneOf")
+	require.Len(t, oneOf, 2)
+	require.Equal(t, "s3", lookup(oneOf, 0, "properties", "kind", "const"))
+	require.Equal(t, []interface{}{"kind", "s3"}, lookup(oneOf, 0, "required"))
+	require.Equal(t, []interface{}{"gcs"}, lookup(oneOf, 0, "not", "anyOf", 0, "required"))
+}
+
+func TestNativeSchemaEmbeddedTypedefs(t *testing.T) {
+	const yaml = `## @typedef {struct} Base - Common settings
+## @validate !self.enabled || self.storageClass != "" - storageClass is needed when enabled
+## @field {bool} enabled=true - Enable the component
+## @field {string} [storageClass] - StorageClass used to store the data
+## @field {int} [port] - Port
+## @requiredIf enabled=true
+
+## @typedef {struct} Sized - Resources @extends Base
+## @field {quantity} size - Volume size
+
+## @typedef {struct} Replica - Replica settings @extends Sized
+## @validate self.replicas > 0 - at least one replica
+## @field {int} replicas - Number of replicas
+## @minimum 1
+
+## @typedef {struct} Proxy
+## @embed {Base}
+## @field {string} [host] - Host
+
+## @param {Replica} replica - Replica
+## @param {[]Proxy} proxies - Proxies
+replica:
+  enabled: true
+  storageClass: local
+  port: 5432
+  size: 10Gi
+  replicas: 2
+proxies: []
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	crd, _ := nativeSchema(t, yaml)
+	require.Contains(t, crd, "- message: storageClass is needed when enabled\n")
+
+	src := goTypes(t, yaml)
+	require.Contains(t, src, "type Replica struct {\n\tSized `json:\",inline\"`\n\t// Number of replicas\n")
+	require.Contains(t, src, "type Sized struct {\n\tBase `json:\",inline\"`\n\t// Volume size\n")
+	require.Contains(t, src, "type Proxy struct {\n\tBase `json:\",inline\"`\n\t// Host\n")
+	require.Equal(t, 1, strings.Count(src, "Enabled bool"))
+}
+
+func TestNativeSchemaTypeAliases(t *testing.T) {
+	const yaml = `## @typedef {string} Hostname - DNS name
+## @pattern ^[a-z0-9.-]+$
+## @maxLength 253
+## @example db.example.org
+
+## @typedef {[]Hostname} Hostnames - List of DNS names
+## @uniqueItems
+## @maxItems 8
+
+## @typedef {map[string]string} Labels
+## @maxProperties 16
+## @keyPattern ^[a-z/.-]+$
+
+## @typedef {struct} Node
+## @field {Hostname} host - Host of the node
+## @field {Labels} labels - Node labels
+## @field {int} [port] - Port
+
+## @typedef {[]Node} Nodes - Cluster nodes
+## @minItems 1
+## @listType map
+## @listMapKey host
+
+## @typedef {quantity} Size
+## @validate quantity(self).compareTo(quantity("1Gi")) >= 0 - at least 1Gi
+
+## @typedef {Node} Primary - Primary node
+## @validate !has(self.port) || self.port != 22 - port 22 is reserved
+
+## @param {Hostname} host="db" - Primary host
+## @param {Hostnames} replicas - Replica hosts
+## @param {*Hostname} [backup] - Backup host
+## @param {Nodes} nodes - Nodes
+## @param {Size} size="2Gi" - Volume size
+## @param {Primary} primary - Primary node
+host: db
+replicas: []
+nodes:
+  - host: a
+    labels: {}
+size: 2Gi
+primary:
+  host: db
+  labels:
+    zone: a
+`
+	require.Empty(t, checkYAML(t, yaml))
+
+	_, schema := nativeSchema(t, yaml)
+	src := goTypes(t, yaml)
+	require.Contains(t, src, "// +kubebuilder:validation:Pattern=\"^[a-z0-9.-]+$\"\ntype Hostname string\n")
+	require.Contains(t, src, "type Size = resource.Quantity\n")
+	require.Contains(t, src, "type Hostnames []Hostname\n")
+	require.Contains(t, src, "Replicas Hostnames `json:\"replicas,omitempty\"`")
+	require.Contains(t, src, "Host Hostname `json:\"host\"`")
+
+	// The hints of an alias reach every param of its type
+	require.Equal(t, []interface{}{"db.example.org"}, lookup(schema, "properties", "host", "examples"))
+	require.Equal(t, []interface{}{"db.example.org"}, lookup(schema, "properties", "replicas", "items", "examples"))
+	require.Equal(t, true, lookup(schema, "properties", "replicas", "uniqueItems"))
+}
+
+func TestNativeSchemaNestedFields(t *testing.T) {
+	const yaml = `## @typedef {struct} Postgresql - Postgres settings
+## @field {string} version - Version
+## @field {struct} backup - Backup config
+## @field {string} backup.schedule="0 2 * * *" - Cron schedule
+## @field {bool} [backup.s3.enabled] - Upload to S3
+## @field {[]struct} users - Users
+## @field {string} users[].name - User name
+## @maxLength 63
+## @field {struct} [extra] - Extra settings
+
+## @param {Postgresql} postgres - Postgres
+postgres:
+  version: "16"
+  backup:
+    schedule: "0 2 * * *"
+  users:
+    - name: app
+`
+	require.Empty(t, checkYAML(t, yaml))
+	nativeSchema(t, yaml)
+
+	tmp := writeTempFile(yaml)
+	defer os.Remove(tmp)
+	rows, err := Parse(tmp)
+	require.NoError(t, err)
+	require.Equal(t, []string{"Postgresql", "backup", "schedule"}, rows[3].Path)
+
+	src := goTypes(t, yaml)
+	require.Contains(t, src, "\tBackup PostgresqlBackup `json:\"backup\"`\n")
+	require.Contains(t, src, "\tS3 PostgresqlBackupS3 `json:\"s3,omitempty\"`\n")
+	require.Contains(t, src, "\tUsers []PostgresqlUsersItem `json:\"users,omitempty\"`\n")
+	require.Contains(t, src, "\tExtra PostgresqlExtra `json:\"extra,omitempty\"`\n")
+	require.Contains(t, src, "type PostgresqlBackup struct {\n")
+	require.NotContains(t, src, "type Struct struct")
+}
@@ -0,0 +1,142 @@
+package openapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+)
+
+/* -------------------------------------------------------------------------- */
+/*  @union typedefs                                                            */
+/* -------------------------------------------------------------------------- */
+
+// Variant is a @variant of a @union: the member named Value holds a Type and
+// is set when the discriminator is Value.
+type Variant struct {
+	Value       string
+	Type        string
+	Description string
+	Pos         diag.Pos // Location of the @variant tag
+}
+
+// variant returns the variant of the @union r named value, or nil.
+func (r *Raw) variant(value string) *Variant {
+	for i := range r.Variants {
+		if r.Variants[i].Value == value {
+			return &r.Variants[i]
+		}
+	}
+	return nil
+}
+
+// addVariants adds the discriminator and the variant members to every @union
+// of root. The discriminator is an enum of the variant values named after
+// the union, e.g. BackupTargetType, and each member is an optional pointer
+// shown when the discriminator selects it. Fields declared with the same
+// names are kept and reported by Check.
+func addVariants(root *Node) {
+	for _, k := range sortedKeys(root.Child) {
+		n := root.Child[k]
+		if n.IsParam || len(n.Variants) == 0 {
+			continue
+		}
+		if _, ok := n.Child[n.Discriminator]; !ok {
+			var values []string
+			for _, v := range n.Variants {
+				values = append(values, v.Value)
+			}
+			name := n.Name + goName(n.Discriminator)
+			for root.Child[name] != nil {
+				name += "Values"
+			}
+			e := ensure(root, name)
+			e.TypeExpr = "string"
+			e.Enums = values
+			e.Comment = "Variants of " + n.Name
+			e.Implicit = true
+			e.Pos = n.Pos
+
+			d := ensure(n, n.Discriminator)
+			d.TypeExpr = name
+			d.Comment = "Selects the variant" // required: not a pointer
+			d.Pos = n.Pos
+		}
+		for _, v := range n.Variants {
+			if _, ok := n.Child[v.Value]; ok {
+				continue
+			}
+			m := ensure(n, v.Value)
+			m.TypeExpr = "*" + v.Type
+			m.Comment = v.Description
+			if t, ok := root.Child[v.Type]; ok && m.Comment == "" {
+				m.Comment = t.Comment
+			}
+			m.OmitEmpty = true
+			m.Pos = v.Pos
+			m.VisibleIf = &Condition{Path: []string{n.Discriminator}, Value: v.Value, Pos: v.Pos}
+		}
+	}
+}
+
+// unionRules returns the CEL rule of the @union n: the member named by the
+// discriminator is set, and no other.
+func unionRules(n *Node) []Validation {
+	if len(n.Variants) == 0 {
+		return nil
+	}
+	var terms []string
+	for _, v := range n.Variants {
+		terms = append(terms, fmt.Sprintf("has(self.%s) == (self.%s == %s)", celField(v.Value), celField(n.Discriminator), strconv.Quote(v.Value)))
+	}
+	return []Validation{{
+		Rule:    strings.Join(terms, " && "),
+		Message: fmt.Sprintf("exactly the member named by %s must be set", n.Discriminator),
+	}}
+}
+
+// variantSchemas returns the JSON Schemas of the variants of the @union n,
+// for its "oneOf": each has its discriminator value and member, and none of
+// the other members.
+func variantSchemas(n *Node) []interface{} {
+	var out []interface{}
+	for _, v := range n.Variants {
+		s := jsonObject{
+			{Key: "properties", Value: jsonObject{
+				{Key: n.Discriminator, Value: jsonObject{{Key: "const", Value: v.Value}}},
+			}},
+			{Key: "required", Value: []string{n.Discriminator, v.Value}},
+		}
+		var others []interface{}
+		for _, o := range n.Variants {
+			if o.Value != v.Value {
+				others = append(others, jsonObject{{Key: "required", Value: []string{o.Value}}})
+			}
+		}
+		if len(others) > 0 {
+			s = append(s, jsonMember{Key: "not", Value: jsonObject{{Key: "anyOf", Value: others}}})
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// unions reports @variant types that are not struct typedefs, and fields of
+// a @union that take the name of its discriminator or of a variant.
+func (c *checker) unions(n *Node) {
+	if n.IsParam || len(n.Variants) == 0 {
+		return
+	}
+	if d := n.Child[n.Discriminator]; d != nil && d.Pos.Line != n.Pos.Line {
+		c.errorf(d.Pos, "%s: field %s is the discriminator of the @union", n.Name, d.Name)
+	}
+	for _, v := range n.Variants {
+		if m := n.Child[v.Value]; m != nil && m.Pos.Line != v.Pos.Line {
+			c.errorf(m.Pos, "%s: field %s is the member of @variant %s", n.Name, m.Name, v.Value)
+		}
+		if t, ok := c.root.Child[v.Type]; ok && (t.IsParam || len(t.Enums) > 0 || t.TypeExpr != "struct") {
+			c.errorf(v.Pos.Find(v.Type), "%s: @variant %s needs a struct typedef, not %s", n.Name, v.Value, v.Type)
+		}
+	}
+}
@@ -6,18 +6,55 @@ package patterns
 // Examples: "foo bar", 'text', {"a":1}, [1,2], true, false, null, -3.5, 42, simpleToken
 const DefaultValuePattern = `(?:"[^"]*"|'[^']*'|\{[^}]*\}|\[[^\]]*\]|true|false|null|-?\d+(?:\.\d+)?|\S+)`
 
-// ParamPattern is the full regex pattern for @param annotations.
+// KeyPattern matches one YAML key in an annotation: a word, or any key in
+// double quotes such as "cert-manager" or "app.kubernetes.io/name". Quoted
+// keys cannot contain quotes, backticks or commas, which would break the
+// JSON tag of the generated field.
+const KeyPattern = `(?:"[^"` + "`" + `,]+"|\w+)`
+
+// ParamPattern is the full regex pattern for @param annotations. Names may be
+// dotted paths into nested objects, with "[]" marking list items:
+// postgres.version, backups[].schedule, ingress."cert-manager".enabled.
 // Groups: 1=type, 2=name (with optional brackets), 3=default value, 4=description
-const ParamPattern = `^#{1,}\s+@param\s+\{([^}]+)\}\s+(\[?\w+\]?)(?:=(` + DefaultValuePattern + `))?(?:\s+-\s+(.*))?$`
+const ParamPattern = `^#{1,}\s+@param\s+\{([^}]+)\}\s+(\[?` + KeyPattern + `(?:(?:\[\])?\.` + KeyPattern + `)*\]?)(?:=(` + DefaultValuePattern + `))?(?:\s+-\s+(.*))?$`
 
 // FieldPattern is the full regex pattern for @field/@property annotations.
+// Like @param names, field names may be dotted paths into nested objects of
+// the parent @typedef: backup.schedule, replicas[].name.
 // Groups: 1=type, 2=name (with optional brackets), 3=default value, 4=description
-// Note: Fields do NOT support dotted paths - they belong to a parent @typedef.
-const FieldPattern = `^#{1,}\s+@(?:field|property)\s+\{([^}]+)\}\s+(\[?\w+\]?)(?:=(` + DefaultValuePattern + `))?(?:\s+-\s+(.*))?$`
-
-// TypedefPattern is the regex pattern for @typedef annotations.
-// Groups: 1=name, 2=description (kind is non-capturing)
-const TypedefPattern = `^#{1,}\s+@typedef\s+\{(?:struct|object)\}\s+(\w+)(?:\s+-\s+(.*))?$`
+const FieldPattern = `^#{1,}\s+@(?:field|property)\s+\{([^}]+)\}\s+(\[?` + KeyPattern + `(?:(?:\[\])?\.` + KeyPattern + `)*\]?)(?:=(` + DefaultValuePattern + `))?(?:\s+-\s+(.*))?$`
+
+// TypedefPattern is the regex pattern for @typedef annotations. The type is
+// struct (or object) for a struct typedef, or any type expression for an
+// alias such as {[]string} or {map[string]string}. The description may end
+// with @extends <Base>, which may also follow the name directly.
+// Groups: 1=type, 2=name, 3=description, 4=@extends without a description
+const TypedefPattern = `^#{1,}\s+@typedef\s+\{([^}]+)\}\s+(\w+)(?:\s+-\s+(.*)|\s+(@extends\s.*))?$`
+
+// ExtendsPattern matches the @extends <Base>, <Other> that ends the
+// description of a @typedef.
+// Groups: 1=comma-separated type names
+const ExtendsPattern = `(?:^|\s+)@extends\s+(\w+(?:\s*,\s*\w+)*)\s*$`
+
+// EmbedPattern is the regex pattern for @embed annotations, which add the
+// fields of a struct typedef to the enclosing @typedef like @extends.
+// Groups: 1=type name
+const EmbedPattern = `^#{1,}\s+@embed\s+\{(\w+)\}\s*$`
+
+// UnionPattern is the regex pattern for @union annotations, typedefs whose
+// discriminator field selects one of their @variant members. The
+// description may end with discriminator=<field>.
+// Groups: 1=name, 2=description
+const UnionPattern = `^#{1,}\s+@union\s+\{(\w+)\}(?:\s+-\s+(.*))?$`
+
+// DiscriminatorPattern matches the discriminator=<field> that ends the
+// description of a @union.
+// Groups: 1=field name
+const DiscriminatorPattern = `(?:^|\s+)discriminator=(\w+)\s*$`
+
+// VariantPattern is the regex pattern for @variant annotations.
+// Groups: 1=discriminator value and member name, 2=variant type, 3=description
+const VariantPattern = `^#{1,}\s+@variant\s+(` + KeyPattern + `)\s+(\w+)(?:\s+-\s+(.*))?$`
 
 // EnumPattern is the regex pattern for @enum annotations.
 // Groups: 1=type, 2=name, 3=description
@@ -69,3 +106,75 @@ const MinItemsPattern = `^#{1,}\s+@minItems\s+(\d+)\s*$`
 // MaxItemsPattern matches @maxItems annotations with integer value.
 // Groups: 1=integer value
 const MaxItemsPattern = `^#{1,}\s+@maxItems\s+(\d+)\s*$`
+
+// ListTypePattern matches @listType annotations.
+// Groups: 1=list type (set, map or atomic)
+const ListTypePattern = `^#{1,}\s+@listType\s+(\S+)\s*$`
+
+// ListMapKeyPattern matches @listMapKey annotations, one key per line.
+// Groups: 1=field name
+const ListMapKeyPattern = `^#{1,}\s+@listMapKey\s+(\S+)\s*$`
+
+// UniqueItemsPattern matches the @uniqueItems flag annotation, a shorthand
+// for @listType set.
+// No groups - presence indicates true
+const UniqueItemsPattern = `^#{1,}\s+@uniqueItems\s*$`
+
+// MinPropertiesPattern matches @minProperties annotations with integer value.
+// Groups: 1=integer value
+const MinPropertiesPattern = `^#{1,}\s+@minProperties\s+(\d+)\s*$`
+
+// MaxPropertiesPattern matches @maxProperties annotations with integer value.
+// Groups: 1=integer value
+const MaxPropertiesPattern = `^#{1,}\s+@maxProperties\s+(\d+)\s*$`
+
+// KeyPatternPattern matches @keyPattern annotations with the regex map keys
+// must match.
+// Groups: 1=regex pattern
+const KeyPatternPattern = `^#{1,}\s+@keyPattern\s+(.+)$`
+
+// ExamplePattern matches @example annotations. An empty value starts a
+// multi-line YAML block on the following "##" lines.
+// Groups: 1=example value (may be empty)
+const ExamplePattern = `^#{1,}\s+@example(?:\s+(.*))?$`
+
+// RequiredPattern matches the @required flag annotation.
+// No groups - presence indicates true
+const RequiredPattern = `^#{1,}\s+@required\s*$`
+
+// ImmutablePattern matches the @immutable flag annotation.
+// No groups - presence indicates true
+const ImmutablePattern = `^#{1,}\s+@immutable\s*$`
+
+// RequiredIfPattern matches @requiredIf annotations.
+// Groups: 1=condition path, 2=value
+const RequiredIfPattern = `^#{1,}\s+@requiredIf\s+([^\s=]+)\s*=\s*(\S.*?)\s*$`
+
+// VisibleIfPattern matches @visibleIf annotations.
+// Groups: 1=condition path, 2=value
+const VisibleIfPattern = `^#{1,}\s+@visibleIf\s+([^\s=]+)\s*=\s*(\S.*?)\s*$`
+
+// ValidatePattern matches @validate annotations with a CEL rule. The message
+// is split off at the last " - " by the parser, as rules may contain one.
+// Groups: 1=rule and optional message
+const ValidatePattern = `^#{1,}\s+@validate\s+(.+)$`
+
+// TagPattern matches any annotation line that starts with an @tag.
+// Groups: 1=tag name
+const TagPattern = `^#{1,}\s+@(\w+)`
+
+// Tags lists every annotation tag understood by the generator.
+var Tags = []string{
+	"param", "field", "property", "typedef", "embed", "union", "variant", "enum", "value", "section",
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"minLength", "maxLength", "pattern", "minItems", "maxItems", "listType", "listMapKey", "uniqueItems",
+	"minProperties", "maxProperties", "keyPattern", "example", "required", "immutable", "requiredIf", "visibleIf", "validate",
+}
+
+// ConstraintTags lists the tags that attach to the preceding @param or @field.
+var ConstraintTags = []string{
+	"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+	"minLength", "maxLength", "pattern", "minItems", "maxItems", "listType", "listMapKey", "uniqueItems",
+	"minProperties", "maxProperties", "keyPattern", "example", "required", "immutable",
+	"requiredIf", "visibleIf",
+}
@@ -3,13 +3,14 @@ package readme
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
-	"github.com/cozystack/cozyvalues-gen/internal/patterns"
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
 	"gopkg.in/yaml.v3"
 )
 
@@ -21,56 +22,16 @@ const (
 	aliasEmptyObject = "emptyobject"
 )
 
-// additional string-format aliases
-// see https://github.com/go-openapi/strfmt/blob/master/README.md
-var stringFormats = []string{
-	"bsonobjectid",
-	"uri",
-	"email",
-	"hostname",
-	"ipv4",
-	"ipv6",
-	"cidr",
-	"mac",
-	"uuid",
-	"uuid3",
-	"uuid4",
-	"uuid5",
-	"isbn",
-	"isbn10",
-	"isbn13",
-	"creditcard",
-	"ssn",
-	"hexcolor",
-	"rgbcolor",
-	"byte",
-	"password",
-	"date",
-}
-
-func isStringFormat(s string) bool {
-	for _, f := range stringFormats {
-		if s == f {
-			return true
-		}
-	}
-	return false
-}
-
-// Pre-compiled regex patterns (compiled once at package init)
-var (
-	sectionRe = regexp.MustCompile(patterns.SectionPattern)
-	paramRe   = regexp.MustCompile(patterns.ParamPattern)
-	fieldRe   = regexp.MustCompile(patterns.FieldPattern)
-	typedefRe = regexp.MustCompile(patterns.TypedefPattern)
-	enumRe    = regexp.MustCompile(patterns.EnumPattern)
-)
-
 type Config struct{}
 
+// Meta is the README view of the annotation tree built by openapi.Build.
 type Meta struct {
-	Sections   []*Section
-	KnownTypes map[string]bool
+	Sections      []*Section
+	KnownTypes    map[string]bool
+	TypeFields    map[string][]FieldMeta // typedef name → its fields
+	EnumBaseTypes map[string]string      // enum name → base type (e.g., ResourcesPreset → string)
+	ValuePos      map[string]diag.Pos    // dotted YAML path → position of its key
+	Required      bool                   // a param or field is required, the tables get a Required column
 }
 
 type Section struct {
@@ -83,6 +44,14 @@ type ParamMeta struct {
 	TypeOriginal string
 	TypeName     string
 	Description  string
+	Doc          string   // long-form documentation, rendered below the table
+	Default      string   // inline default from the annotation
+	HasDefault   bool     // Default is set, even if empty
+	Rules        []string // constraints and enum values, see rules
+	Examples     []string // @example values in source form
+	Implicit     bool     // parent of dotted params only, see openapi.Node
+	Required     bool     // see openapi.Node.IsRequired
+	Pos          diag.Pos
 }
 
 type FieldMeta struct {
@@ -90,6 +59,14 @@ type FieldMeta struct {
 	Name           string
 	Type           string
 	Description    string
+	Doc            string
+	Default        string
+	HasDefault     bool
+	Rules          []string
+	Examples       []string
+	Implicit       bool
+	Required       bool
+	Pos            diag.Pos
 }
 
 type ParamToRender struct {
@@ -97,18 +74,44 @@ type ParamToRender struct {
 	Description string
 	Type        string
 	Value       string
+	Required    string // "yes" or "no"; empty when there is no Required column
+	Doc         string
+	Examples    []string
+}
+
+// renderer holds the state of one README render, so that several values
+// files can be processed concurrently.
+type renderer struct {
+	values        map[string]interface{}
+	typeFields    map[string][]FieldMeta
+	enumBaseTypes map[string]string
+	required      bool
+}
+
+func newRenderer(meta *Meta, values map[string]interface{}) *renderer {
+	return &renderer{values: values, typeFields: meta.TypeFields, enumBaseTypes: meta.EnumBaseTypes, required: meta.Required}
 }
 
-var valuesMap map[string]interface{}
-var typeFields map[string][]FieldMeta
-var knownTypesCache map[string]bool
-var enumBaseTypes map[string]string
+// requiredCell returns the Required column of a row, if there is one.
+func (r *renderer) requiredCell(required bool) string {
+	switch {
+	case !r.required:
+		return ""
+	case required:
+		return "yes"
+	}
+	return "no"
+}
 
 func createValuesObject(path string) (map[string]interface{}, error) {
-	data, err := ioutil.ReadFile(path)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+	return valuesObject(data)
+}
+
+func valuesObject(data []byte) (map[string]interface{}, error) {
 	var vals map[string]interface{}
 	if err := yaml.Unmarshal(data, &vals); err != nil {
 		return nil, err
@@ -121,179 +124,219 @@ func parseMetadataComments(path string) (*Meta, error) {
 	if err != nil {
 		return nil, err
 	}
-
-	// YAML node tree
-	var root yaml.Node
-	if err := yaml.Unmarshal(data, &root); err != nil {
+	rows, err := openapi.ParseBytes(path, data, openapi.ParseOptions{})
+	if err != nil {
 		return nil, err
 	}
+	return newMeta(openapi.Build(rows), path, data)
+}
 
-	typeFields = make(map[string][]FieldMeta)
-	var sections []*Section
-	var current *Section
-	var allParams []ParamMeta
-
-	// ───────────── Parse all annotations in a single pass ─────────────
-	lines := strings.Split(string(data), "\n")
-	var currentTypeDef string
-	knownTypesCache = make(map[string]bool) // Track all defined types including enums
-	enumBaseTypes = make(map[string]string) // Track enum name -> base type (e.g., ResourcesPreset -> string)
-	knownTypes := knownTypesCache
-
-	seen := map[fieldKey]struct{}{}
-	addField := func(parent, name, typ, desc string) {
-		if parent == "" || name == "" {
-			return
-		}
-		k := fieldKey{parent: parent, name: name}
-		if _, dup := seen[k]; dup {
-			return
-		}
-		typeFields[parent] = append(typeFields[parent], FieldMeta{
-			ParentTypeName: parent,
-			Name:           name,
-			Type:           typ,
-			Description:    desc,
-		})
-		seen[k] = struct{}{}
+// newMeta collects what the README needs from the annotation tree. values
+// is the raw values file, used for the positions of errors.
+func newMeta(root *openapi.Node, file string, values []byte) (*Meta, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(values, &doc); err != nil {
+		return nil, err
+	}
+	meta := &Meta{
+		KnownTypes:    map[string]bool{},
+		TypeFields:    map[string][]FieldMeta{},
+		EnumBaseTypes: map[string]string{},
+		ValuePos:      map[string]diag.Pos{},
+		Required:      hasRequired(root),
 	}
 
-	for _, raw := range lines {
-		line := strings.TrimSpace(raw)
-
-		if m := sectionRe.FindStringSubmatch(line); m != nil {
-			sec := &Section{Name: m[1]}
-			sections = append(sections, sec)
-			current = sec
-			currentTypeDef = ""
-			continue
+	var params []*openapi.Node
+	for _, name := range root.ChildNames() {
+		n := root.Child[name]
+		if n.IsParam {
+			params = append(params, n)
 		}
-
-		if m := typedefRe.FindStringSubmatch(line); m != nil {
-			currentTypeDef = m[1]
-			knownTypes[currentTypeDef] = true
+		switch {
+		case !n.Pos.IsValid():
+			// referenced but never declared
 			continue
-		}
-
-		if m := enumRe.FindStringSubmatch(line); m != nil {
-			baseType := m[1] // e.g., "string"
-			enumName := m[2]
-			knownTypes[enumName] = true
-			enumBaseTypes[enumName] = baseType
-			currentTypeDef = ""
+		case n.IsAlias():
+			// params and fields show the type it names
 			continue
-		}
-
-		if m := paramRe.FindStringSubmatch(line); m != nil {
-			typ := m[1]
-			name := strings.Trim(m[2], "[]")
-			// defaultVal in m[3] if present (for @param syntax)
-			desc := ""
-			if len(m) > 4 {
-				desc = m[4]
-			}
-			pm := ParamMeta{
-				Name:         name,
-				TypeOriginal: typ,
-				TypeName:     resolveTypeName(typ),
-				Description:  desc,
-			}
-			allParams = append(allParams, pm)
-			if current != nil {
-				current.Parameters = append(current.Parameters, pm)
-			} else {
-				if len(sections) == 0 {
-					sections = append(sections, &Section{Name: "Parameters"})
-				}
-				sections[0].Parameters = append(sections[0].Parameters, pm)
-			}
-			currentTypeDef = ""
+		case !n.IsParam && isEnum(n):
+			meta.KnownTypes[name] = true
+			meta.EnumBaseTypes[name] = n.TypeExpr
+			continue
+		case n.IsParam && len(n.Child) == 0:
 			continue
 		}
 
-		if m := fieldRe.FindStringSubmatch(line); m != nil {
-			typ := m[1]
-			fieldName := strings.Trim(m[2], "[]")
-			defaultVal := ""
-			if len(m) > 3 && m[3] != "" {
-				defaultVal = m[3]
-			}
-			desc := ""
-			if len(m) > 4 {
-				desc = m[4]
-			}
-
-			// If default value is specified, append it to type for extractAnnotationDefault to process
-			if defaultVal != "" {
-				typ = typ + " default=" + defaultVal
-			}
+		// A typedef named like a param shares its node; its fields
+		// describe the param's type.
+		meta.KnownTypes[name] = true
+		owner := name
+		if n.IsParam {
+			owner = openapi.BaseType(n.TypeExpr)
+		}
+		for _, f := range n.ByLine() {
+			meta.TypeFields[owner] = append(meta.TypeFields[owner], FieldMeta{
+				ParentTypeName: owner,
+				Name:           f.Name,
+				Type:           openapi.Underlying(root, f.TypeExpr),
+				Description:    f.Comment,
+				Doc:            f.Doc,
+				Default:        f.DefaultVal,
+				HasDefault:     f.DefaultInline,
+				Rules:          rules(root, f),
+				Examples:       f.ExampleValues(),
+				Implicit:       f.Implicit,
+				Required:       f.IsRequired(),
+				Pos:            f.Pos,
+			})
+		}
+	}
 
-			// If we have current typedef, use it as parent
-			if currentTypeDef != "" {
-				addField(currentTypeDef, fieldName, typ, desc)
-			}
+	sort.Slice(params, func(i, j int) bool { return params[i].Order < params[j].Order })
+	sections := map[string]*Section{}
+	for _, n := range params {
+		name := n.Section
+		if name == "" {
+			name = "Parameters"
 		}
+		sec, ok := sections[name]
+		if !ok {
+			sec = &Section{Name: name}
+			sections[name] = sec
+			meta.Sections = append(meta.Sections, sec)
+		}
+		sec.Parameters = append(sec.Parameters, ParamMeta{
+			Name:         n.Name,
+			TypeOriginal: openapi.Underlying(root, n.TypeExpr),
+			TypeName:     deriveTypeName(openapi.Underlying(root, n.TypeExpr)),
+			Description:  n.Comment,
+			Doc:          n.Doc,
+			Default:      n.DefaultVal,
+			HasDefault:   n.DefaultInline,
+			Rules:        rules(root, n),
+			Examples:     n.ExampleValues(),
+			Implicit:     n.Implicit,
+			Required:     n.IsRequired(),
+			Pos:          n.Pos,
+		})
 	}
 
-	// build param-name → type alias map
-	aliasMap := buildAliasMap(allParams)
+	if len(doc.Content) > 0 {
+		collectValuePos(doc.Content[0], "", file, strings.Split(string(values), "\n"), meta.ValuePos)
+	}
+	return meta, nil
+}
 
-	// Resolve aliased types in typeFields
-	for parent := range typeFields {
-		if real, ok := aliasMap[parent]; ok && real != parent {
-			// Move fields from alias to real type
-			if _, exists := typeFields[real]; !exists {
-				typeFields[real] = typeFields[parent]
-			} else {
-				typeFields[real] = append(typeFields[real], typeFields[parent]...)
-			}
+// hasRequired reports whether a param, or a field below n, is required
+// under the policy the tree was parsed with, see openapi.Node.IsRequired.
+// The discriminator of a @union does not count: its variants imply it.
+func hasRequired(n *openapi.Node) bool {
+	for _, c := range n.Child {
+		discriminator := len(n.Variants) > 0 && c.Name == n.Discriminator
+		if (c.IsParam || n.Parent != nil) && c.IsRequired() && !discriminator {
+			return true
+		}
+		if hasRequired(c) {
+			return true
 		}
 	}
-
-	return &Meta{Sections: sections, KnownTypes: knownTypes}, nil
+	return false
 }
 
-func resolveTypeName(typ string) string {
-	if idx := strings.IndexAny(typ, " \t"); idx != -1 {
-		typ = typ[:idx]
+func isEnum(n *openapi.Node) bool { return len(n.Enums) > 0 || n.TypeExpr != "struct" }
+
+// rules lists the enum values, validation constraints and conditions of n in
+// the words shown next to its description, including those of the alias its
+// type names.
+func rules(root, n *openapi.Node) []string {
+	var out []string
+	n = openapi.Unaliased(root, n)
+	if n.Immutable {
+		out = append(out, "immutable")
 	}
-	if strings.HasPrefix(typ, "[]") {
-		return typ[2:]
+	if e, ok := root.Child[openapi.BaseType(openapi.Underlying(root, n.TypeExpr))]; ok && !e.IsParam && len(e.Enums) > 0 {
+		vals := make([]string, len(e.Enums))
+		for i, v := range e.Enums {
+			vals[i] = "`" + v + "`"
+		}
+		out = append(out, "one of "+strings.Join(vals, ", "))
 	}
-	if strings.HasPrefix(typ, "map[") {
-		if idx := strings.LastIndex(typ, "]"); idx != -1 && idx+1 < len(typ) {
-			return typ[idx+1:]
+	bound := func(name string, v *float64, exclusive bool) {
+		if v == nil {
+			return
 		}
+		if exclusive {
+			name = "exclusive " + name
+		}
+		out = append(out, name+" "+strconv.FormatFloat(*v, 'g', -1, 64))
 	}
-	if strings.HasPrefix(typ, "*") {
-		return typ[1:]
+	count := func(name string, v *int64) {
+		if v != nil {
+			out = append(out, fmt.Sprintf("%s %d", name, *v))
+		}
 	}
-	return typ
-}
-
-func buildAliasMap(params []ParamMeta) map[string]string {
-	out := make(map[string]string)
-	for _, p := range params {
-		out[p.Name] = p.TypeName
+	bound("minimum", n.Minimum, n.ExclusiveMinimum)
+	bound("maximum", n.Maximum, n.ExclusiveMaximum)
+	count("min length", n.MinLength)
+	count("max length", n.MaxLength)
+	if n.Pattern != "" {
+		out = append(out, "pattern `"+strings.ReplaceAll(n.Pattern, "|", `\|`)+"`")
+	}
+	count("min items", n.MinItems)
+	count("max items", n.MaxItems)
+	switch n.ListType {
+	case "set":
+		out = append(out, "unique")
+	case "map":
+		out = append(out, "unique by `"+strings.Join(n.ListMapKeys, "`, `")+"`")
+	}
+	count("min properties", n.MinProperties)
+	count("max properties", n.MaxProperties)
+	if n.KeyPattern != "" {
+		out = append(out, "key pattern `"+strings.ReplaceAll(n.KeyPattern, "|", `\|`)+"`")
+	}
+	if n.RequiredIf != nil {
+		out = append(out, "required if `"+strings.ReplaceAll(n.RequiredIf.String(), "|", `\|`)+"`")
+	}
+	if n.VisibleIf != nil {
+		out = append(out, "shown if `"+strings.ReplaceAll(n.VisibleIf.String(), "|", `\|`)+"`")
 	}
 	return out
 }
 
-func combine(vals map[string]interface{}) { valuesMap = vals }
-
-// place below helpers (before buildParamsToRender)
-
-var reAnnoDefault = regexp.MustCompile(`\bdefault\s*=\s*(?:"([^"]*)"|(\{[^}]*\}|$begin:math:display$[^$end:math:display$]*\]|true|false|-?\d+(?:\.\d+)?))`)
-
-func extractAnnotationDefault(typeExpr string) (string, bool) {
-	m := reAnnoDefault.FindStringSubmatch(typeExpr)
-	if m == nil {
-		return "", false
+// describe appends the rules of a param or field to its description.
+func describe(desc string, rules []string) string {
+	if len(rules) == 0 {
+		return desc
 	}
-	if m[1] != "" {
-		return m[1], true
+	note := "(" + strings.Join(rules, ", ") + ")"
+	if desc == "" {
+		return note
+	}
+	return desc + " " + note
+}
+
+// collectValuePos records the position of every mapping key and sequence
+// item below n, keyed by the same dotted paths validateValues reports.
+func collectValuePos(n *yaml.Node, prefix, file string, lines []string, out map[string]diag.Pos) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			p := k.Value
+			if prefix != "" {
+				p = prefix + "." + k.Value
+			}
+			out[p] = diag.At(file, lines, k.Line, k.Column)
+			collectValuePos(v, p, file, lines, out)
+		}
+	case yaml.SequenceNode:
+		for i, item := range n.Content {
+			p := fmt.Sprintf("%s[%d]", prefix, i)
+			out[p] = diag.At(file, lines, item.Line, item.Column)
+			collectValuePos(item, p, file, lines, out)
+		}
 	}
-	return m[2], true
 }
 
 func renderAnnotationDefault(val string) string {
@@ -313,11 +356,15 @@ func renderAnnotationDefault(val string) string {
 
 // lookupNested navigates through nested maps using a dotted path.
 // For example, "qdrant.persistence.size" will navigate:
-// valuesMap["qdrant"]["persistence"]["size"]
+// values["qdrant"]["persistence"]["size"]
 func lookupNested(values map[string]any, path string) (any, bool) {
 	if path == "" {
 		return nil, false
 	}
+	// Quoted keys may contain dots themselves.
+	if v, ok := values[path]; ok {
+		return v, true
+	}
 	parts := strings.Split(path, ".")
 	var current any = values
 	for _, part := range parts {
@@ -339,7 +386,7 @@ func lookupNested(values map[string]any, path string) (any, bool) {
 //	BuildParamsToRender – table rows for README
 //
 // ---------------------------------------------------------------------------
-func buildParamsToRender(params []ParamMeta) []ParamToRender {
+func (r *renderer) buildParamsToRender(params []ParamMeta) []ParamToRender {
 	var out []ParamToRender
 
 	for _, pm := range params {
@@ -351,7 +398,7 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 		isMap := strings.HasPrefix(baseForKind, "map[")
 		isPtr := strings.HasPrefix(orig, "*")
 		isEnum := false
-		if _, ok := enumBaseTypes[baseType]; ok {
+		if _, ok := r.enumBaseTypes[baseType]; ok {
 			isEnum = true
 		}
 
@@ -362,9 +409,9 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 
 		switch {
 		case isArrayPrim:
-			raw, exists := lookupNested(valuesMap, pm.Name)
+			raw, exists := lookupNested(r.values, pm.Name)
 			if !exists {
-				if def, ok := extractAnnotationDefault(orig); ok {
+				if def, ok := pm.Default, pm.HasDefault; ok {
 					val = renderAnnotationDefault(def)
 				} else {
 					val = defaultValueForType(orig)
@@ -374,14 +421,14 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 			}
 
 		case isArray:
-			rawVal, _ := lookupNested(valuesMap, pm.Name)
+			rawVal, _ := lookupNested(r.values, pm.Name)
 			if raw, ok := rawVal.([]any); ok {
 				if len(raw) > 0 {
 					val = "`[...]`"
 				} else {
 					val = "`[]`"
 				}
-			} else if def, ok := extractAnnotationDefault(orig); ok {
+			} else if def, ok := pm.Default, pm.HasDefault; ok {
 				val = renderAnnotationDefault(def)
 			} else {
 				val = "`[]`"
@@ -389,23 +436,23 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 
 		case isMap:
 			// Check if map is empty in values.yaml
-			rawVal, _ := lookupNested(valuesMap, pm.Name)
+			rawVal, _ := lookupNested(r.values, pm.Name)
 			if raw, ok := rawVal.(map[string]any); ok && len(raw) == 0 {
 				// Empty map always renders as {}
 				val = "`{}`"
-			} else if !isPrimitive(baseType) && len(typeFields[baseType]) > 0 {
+			} else if !isPrimitive(baseType) && len(r.typeFields[baseType]) > 0 {
 				// Non-empty map with structured type renders as {...}
 				val = "`{...}`"
-			} else if def, ok := extractAnnotationDefault(orig); ok {
+			} else if def, ok := pm.Default, pm.HasDefault; ok {
 				val = renderAnnotationDefault(def)
 			} else {
 				val = "`{}`"
 			}
 
 		case isPtrPrim:
-			raw, exists := lookupNested(valuesMap, pm.Name)
+			raw, exists := lookupNested(r.values, pm.Name)
 			if !exists {
-				if def, ok := extractAnnotationDefault(orig); ok {
+				if def, ok := pm.Default, pm.HasDefault; ok {
 					val = renderAnnotationDefault(def)
 				} else {
 					val = "`null`"
@@ -415,9 +462,9 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 			}
 
 		case isPtr && (strings.HasPrefix(baseForKind, "[]") || strings.HasPrefix(baseForKind, "map[")):
-			raw, exists := lookupNested(valuesMap, pm.Name)
+			raw, exists := lookupNested(r.values, pm.Name)
 			if !exists {
-				if def, ok := extractAnnotationDefault(orig); ok {
+				if def, ok := pm.Default, pm.HasDefault; ok {
 					val = renderAnnotationDefault(def)
 				} else {
 					val = "`null`"
@@ -433,7 +480,7 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 			}
 
 		case isPtr && !isPtrPrim:
-			if def, ok := extractAnnotationDefault(orig); ok {
+			if def, ok := pm.Default, pm.HasDefault; ok {
 				val = renderAnnotationDefault(def)
 			} else {
 				val = "`null`"
@@ -441,9 +488,9 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 
 		case isEnum:
 			// Treat enums like primitives - extract actual value
-			raw, exists := lookupNested(valuesMap, pm.Name)
+			raw, exists := lookupNested(r.values, pm.Name)
 			if !exists {
-				if def, ok := extractAnnotationDefault(orig); ok {
+				if def, ok := pm.Default, pm.HasDefault; ok {
 					val = renderAnnotationDefault(def)
 				} else {
 					val = defaultValueForType(orig)
@@ -452,17 +499,17 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 				val = valueString(raw, exists, orig)
 			}
 
-		case !isPrimitive(baseType) && len(typeFields[baseType]) > 0:
-			if def, ok := extractAnnotationDefault(orig); ok {
+		case !isPrimitive(baseType) && len(r.typeFields[baseType]) > 0:
+			if def, ok := pm.Default, pm.HasDefault; ok {
 				val = renderAnnotationDefault(def)
 			} else {
 				val = "`{}`"
 			}
 
 		default:
-			raw, exists := lookupNested(valuesMap, pm.Name)
+			raw, exists := lookupNested(r.values, pm.Name)
 			if !exists {
-				if def, ok := extractAnnotationDefault(orig); ok {
+				if def, ok := pm.Default, pm.HasDefault; ok {
 					val = renderAnnotationDefault(def)
 				} else {
 					val = defaultValueForType(orig)
@@ -472,19 +519,25 @@ func buildParamsToRender(params []ParamMeta) []ParamToRender {
 			}
 		}
 
-		out = append(out, ParamToRender{
-			Path:        pm.Name,
-			Description: pm.Description,
-			Type:        normalizeType(orig),
-			Value:       val,
-		})
-		rawForTraverse, _ := lookupNested(valuesMap, pm.Name)
-		out = append(out, traverseParam(pm, rawForTraverse, true)...)
+		// Objects that only hold dotted params are listed through them
+		if !pm.Implicit {
+			out = append(out, ParamToRender{
+				Path:        pm.Name,
+				Description: describe(pm.Description, pm.Rules),
+				Type:        r.normalizeType(orig),
+				Value:       val,
+				Required:    r.requiredCell(pm.Required),
+				Doc:         pm.Doc,
+				Examples:    pm.Examples,
+			})
+		}
+		rawForTraverse, _ := lookupNested(r.values, pm.Name)
+		out = append(out, r.traverseParam(pm, rawForTraverse, true)...)
 	}
 	return out
 }
 
-func traverseByType(path string, raw interface{}, typeName string) []ParamToRender {
+func (r *renderer) traverseByType(path string, raw interface{}, typeName string) []ParamToRender {
 	var rows []ParamToRender
 	m := map[string]interface{}{}
 	if mm, ok := raw.(map[string]interface{}); ok {
@@ -493,9 +546,9 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 
 	rowSeen := map[string]struct{}{}
 
-	ensureSynthFromDefault := func(parentPath, ft string) []ParamToRender {
+	ensureSynthFromDefault := func(parentPath string, fm FieldMeta) []ParamToRender {
 		var out []ParamToRender
-		if def, ok := extractAnnotationDefault(ft); ok {
+		if def, ok := fm.Default, fm.HasDefault; ok {
 			var parsed interface{}
 			if err := yaml.Unmarshal([]byte(def), &parsed); err == nil {
 				if mm, ok := parsed.(map[string]interface{}); ok {
@@ -518,7 +571,7 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 						out = append(out, ParamToRender{
 							Path:        parentPath + "." + k,
 							Description: "",
-							Type:        normalizeType(typ),
+							Type:        r.normalizeType(typ),
 							Value:       valueString(val, true, typ),
 						})
 					}
@@ -528,11 +581,11 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 		return out
 	}
 
-	for _, fm := range typeFields[typeName] {
+	for _, fm := range r.typeFields[typeName] {
 		if fm.Name == "" {
 			continue
 		}
-		key := path + "." + fm.Name + "\x00" + normalizeType(fm.Type)
+		key := path + "." + fm.Name + "\x00" + r.normalizeType(fm.Type)
 		if _, ok := rowSeen[key]; ok {
 			continue
 		}
@@ -546,7 +599,7 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 		isArray := strings.HasPrefix(ft, "[]")
 		isMap := strings.HasPrefix(ft, "map[")
 		isEnum := false
-		if _, ok := enumBaseTypes[baseType]; ok {
+		if _, ok := r.enumBaseTypes[baseType]; ok {
 			isEnum = true
 		}
 		isArrayOfPrimitives := isArray && (isPrimitive(baseType) || isEnum)
@@ -566,7 +619,7 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 						value = "`[]`"
 					}
 				}
-			} else if def, ok := extractAnnotationDefault(fm.Type); ok {
+			} else if def, ok := fm.Default, fm.HasDefault; ok {
 				value = renderAnnotationDefault(def)
 			} else if hasPtr {
 				value = "`null`"
@@ -577,7 +630,7 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 		case isMap:
 			if okVal {
 				value = "`{}`"
-			} else if def, ok := extractAnnotationDefault(fm.Type); ok {
+			} else if def, ok := fm.Default, fm.HasDefault; ok {
 				value = renderAnnotationDefault(def)
 			} else if hasPtr {
 				value = "`null`"
@@ -589,7 +642,7 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 			// Treat enums like primitives - extract actual value
 			if okVal {
 				value = valueString(val, okVal, fm.Type)
-			} else if def, ok := extractAnnotationDefault(fm.Type); ok {
+			} else if def, ok := fm.Default, fm.HasDefault; ok {
 				value = renderAnnotationDefault(def)
 			} else if hasPtr {
 				value = "`null`"
@@ -600,55 +653,60 @@ func traverseByType(path string, raw interface{}, typeName string) []ParamToRend
 		case isDirectPrimitive:
 			if okVal {
 				value = valueString(val, okVal, fm.Type)
-			} else if def, ok := extractAnnotationDefault(fm.Type); ok {
+			} else if def, ok := fm.Default, fm.HasDefault; ok {
 				value = renderAnnotationDefault(def)
 			}
 
 		default:
 			if hasPtr {
-				if def, ok := extractAnnotationDefault(fm.Type); ok {
+				if def, ok := fm.Default, fm.HasDefault; ok {
 					value = renderAnnotationDefault(def)
 				} else {
 					value = "`null`"
 				}
-			} else if def, ok := extractAnnotationDefault(fm.Type); ok {
+			} else if def, ok := fm.Default, fm.HasDefault; ok {
 				value = renderAnnotationDefault(def)
 			} else {
 				value = "`{}`"
 			}
 		}
 
-		rows = append(rows, ParamToRender{
-			Path:        path + "." + fm.Name,
-			Description: fm.Description,
-			Type:        normalizeType(fm.Type),
-			Value:       value,
-		})
+		if !fm.Implicit {
+			rows = append(rows, ParamToRender{
+				Path:        path + "." + fm.Name,
+				Description: describe(fm.Description, fm.Rules),
+				Type:        r.normalizeType(fm.Type),
+				Value:       value,
+				Required:    r.requiredCell(fm.Required),
+				Doc:         fm.Doc,
+				Examples:    fm.Examples,
+			})
+		}
 		rowSeen[key] = struct{}{}
 
 		switch {
 		case strings.HasPrefix(ft, "[]"):
 			elt := deriveTypeName(ft)
-			if _, has := typeFields[elt]; has {
-				rows = append(rows, traverseByType(path+"."+fm.Name+"[i]", map[string]interface{}{}, elt)...)
+			if _, has := r.typeFields[elt]; has {
+				rows = append(rows, r.traverseByType(path+"."+fm.Name+"[i]", map[string]interface{}{}, elt)...)
 			} else {
-				rows = append(rows, ensureSynthFromDefault(path+"."+fm.Name+"[i]", fm.Type)...)
+				rows = append(rows, ensureSynthFromDefault(path+"."+fm.Name+"[i]", fm)...)
 			}
 		case strings.HasPrefix(ft, "map["):
 			elt := deriveTypeName(ft)
-			if _, has := typeFields[elt]; has {
-				rows = append(rows, traverseByType(path+"."+fm.Name+"[name]", map[string]interface{}{}, elt)...)
+			if _, has := r.typeFields[elt]; has {
+				rows = append(rows, r.traverseByType(path+"."+fm.Name+"[name]", map[string]interface{}{}, elt)...)
 			}
 		default:
 			child := deriveTypeName(ft)
-			if _, has := typeFields[child]; has {
+			if _, has := r.typeFields[child]; has {
 				childRaw := map[string]interface{}{}
 				if okVal {
 					if mm2, ok2 := val.(map[string]interface{}); ok2 {
 						childRaw = mm2
 					}
 				}
-				childRows := traverseByType(path+"."+fm.Name, childRaw, child)
+				childRows := r.traverseByType(path+"."+fm.Name, childRaw, child)
 				// If child type has no fields (empty struct), still ensure the row is created
 				if len(childRows) == 0 && has {
 					// Empty struct - the row for the field itself is already added above,
@@ -692,7 +750,7 @@ func isDeepEmpty(v interface{}) bool {
 	}
 }
 
-func traverseParam(pm ParamMeta, rawVal interface{}, exists bool) []ParamToRender {
+func (r *renderer) traverseParam(pm ParamMeta, rawVal interface{}, exists bool) []ParamToRender {
 	var rows []ParamToRender
 
 	torig := pm.TypeOriginal
@@ -700,19 +758,19 @@ func traverseParam(pm ParamMeta, rawVal interface{}, exists bool) []ParamToRende
 	if strings.HasPrefix(t, "[]") {
 		elt := deriveTypeName(t) // element type name (e.g., "gpu")
 		if !isPrimitive(elt) {
-			rows = append(rows, traverseByType(fmt.Sprintf("%s[i]", pm.Name), map[string]interface{}{}, elt)...)
+			rows = append(rows, r.traverseByType(fmt.Sprintf("%s[i]", pm.Name), map[string]interface{}{}, elt)...)
 		}
 		return rows
 	}
 	if strings.HasPrefix(t, "map[") {
 		elt := deriveTypeName(t) // value type
-		rows = append(rows, traverseByType(fmt.Sprintf("%s[name]", pm.Name), map[string]interface{}{}, elt)...)
+		rows = append(rows, r.traverseByType(fmt.Sprintf("%s[name]", pm.Name), map[string]interface{}{}, elt)...)
 		return rows
 	}
 
 	// scalar/object param
 	base := deriveTypeName(torig)
-	rows = append(rows, traverseByType(pm.Name, rawVal, base)...)
+	rows = append(rows, r.traverseByType(pm.Name, rawVal, base)...)
 	return rows
 }
 
@@ -734,7 +792,7 @@ func deriveTypeName(t string) string {
 	return t
 }
 
-func normalizeType(t string) string {
+func (r *renderer) normalizeType(t string) string {
 	if idx := strings.IndexAny(t, " \t"); idx != -1 {
 		t = t[:idx]
 	}
@@ -751,10 +809,10 @@ func normalizeType(t string) string {
 	if strings.HasPrefix(t, "*") {
 		base := strings.TrimPrefix(t, "*")
 		if strings.HasPrefix(base, "[]") || strings.HasPrefix(base, "map[") {
-			return normalizeType(base)
+			return r.normalizeType(base)
 		}
 		// Check if pointer to enum type
-		if baseType, isEnum := enumBaseTypes[base]; isEnum {
+		if baseType, isEnum := r.enumBaseTypes[base]; isEnum {
 			return "*" + baseType
 		}
 		// pointer to non-primitive, non-collection → *object
@@ -762,7 +820,7 @@ func normalizeType(t string) string {
 			return "*object"
 		}
 		// pointer to primitive (or special primitives) stays as-is
-		return "*" + base
+		return "*" + unionName(base)
 	}
 
 	// if underlying base is primitive, preserve it verbatim (after emptyobject normalization above)
@@ -772,14 +830,14 @@ func normalizeType(t string) string {
 		if base == aliasEmptyObject {
 			return strings.ReplaceAll(t, aliasEmptyObject, "object")
 		}
-		return t
+		return strings.TrimSuffix(t, base) + unionName(base)
 	}
 
 	// Handle array types
 	if strings.HasPrefix(t, "[]") {
 		base := deriveTypeName(t)
 		// Check if array of enum type
-		if baseType, isEnum := enumBaseTypes[base]; isEnum {
+		if baseType, isEnum := r.enumBaseTypes[base]; isEnum {
 			return "[]" + baseType
 		}
 		if !isPrimitive(base) {
@@ -804,7 +862,7 @@ func normalizeType(t string) string {
 	// non-primitive scalar: check if it's an enum first
 	if !isPrimitive(t) && !strings.HasPrefix(t, "[]") && !strings.HasPrefix(t, "map[") {
 		// Check if it's a known enum type
-		if baseType, isEnum := enumBaseTypes[t]; isEnum {
+		if baseType, isEnum := r.enumBaseTypes[t]; isEnum {
 			return baseType
 		}
 		return "object"
@@ -856,14 +914,9 @@ func valueString(raw interface{}, exists bool, t string) string {
 	}
 }
 
-type fieldKey struct {
-	parent string
-	name   string
-}
-
 func isPrimitive(t string) bool {
 	base := strings.TrimPrefix(t, "*")
-	if isStringFormat(base) {
+	if openapi.IsStringFormat(base) || openapi.UnionMembers(base) != nil {
 		return true
 	}
 	switch base {
@@ -876,15 +929,36 @@ func isPrimitive(t string) bool {
 	}
 }
 
+// unionName spells the scalar union t by its types, so that intOrString and
+// string|int both read int|string.
+func unionName(t string) string {
+	if m := openapi.UnionMembers(t); m != nil {
+		return strings.Join(m, "|")
+	}
+	return t
+}
+
 func markdownTable(rows []ParamToRender) string {
+	required := false
+	for _, r := range rows {
+		required = required || r.Required != ""
+	}
 	data := [][]string{{"Name", "Description", "Type", "Value"}}
+	if required {
+		data[0] = append(data[0], "Required")
+	}
 	for _, r := range rows {
-		data = append(data, []string{
+		row := []string{
 			fmt.Sprintf("`%s`", r.Path),
 			r.Description,
-			fmt.Sprintf("`%s`", r.Type),
+			// A bar ends the cell even inside a code span
+			fmt.Sprintf("`%s`", strings.ReplaceAll(r.Type, "|", `\|`)),
 			r.Value,
-		})
+		}
+		if required {
+			row = append(row, r.Required)
+		}
+		data = append(data, row)
 	}
 	widths := make([]int, len(data[0]))
 	for _, row := range data {
@@ -912,25 +986,44 @@ func markdownTable(rows []ParamToRender) string {
 	return sb.String()
 }
 
-func renderSection(sec *Section) string {
-	rows := buildParamsToRender(sec.Parameters)
-	return fmt.Sprintf("\n### %s\n\n%s", sec.Name, markdownTable(rows))
+func (r *renderer) renderSection(sec *Section) string {
+	rows := r.buildParamsToRender(sec.Parameters)
+	return fmt.Sprintf("\n### %s\n\n%s%s", sec.Name, markdownTable(rows), docBlocks(rows))
 }
 
-func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, values map[string]any, knownTypes map[string]bool) error {
+// docBlocks renders the long-form documentation and examples of rows as
+// collapsible blocks below the table, so that the table itself stays one
+// line per row.
+func docBlocks(rows []ParamToRender) string {
+	var sb strings.Builder
+	seen := map[string]bool{}
+	for _, r := range rows {
+		if (r.Doc == "" && len(r.Examples) == 0) || seen[r.Path] {
+			continue
+		}
+		seen[r.Path] = true
+		var parts []string
+		if r.Doc != "" {
+			parts = append(parts, r.Doc)
+		}
+		for _, ex := range r.Examples {
+			parts = append(parts, "Example:\n\n```yaml\n"+ex+"\n```")
+		}
+		fmt.Fprintf(&sb, "\n<details>\n<summary><code>%s</code></summary>\n\n%s\n\n</details>\n", r.Path, strings.Join(parts, "\n\n"))
+	}
+	return sb.String()
+}
+
+func validateValues(params []ParamMeta, values map[string]any, meta *Meta) error {
+	knownTypes, typeFields := meta.KnownTypes, meta.TypeFields
 	paramMap := make(map[string]ParamMeta, len(params))
-	// Track which top-level keys have dotted path params (e.g., "postgres" has "postgres.version")
-	dottedPathRoots := make(map[string]bool)
 	for _, p := range params {
 		paramMap[p.Name] = p
-		// If param name contains a dot, mark the root as having dotted path params
-		if idx := strings.Index(p.Name, "."); idx > 0 {
-			dottedPathRoots[p.Name[:idx]] = true
-		}
 	}
 
-	var checkValue func(path string, val interface{}, typ string) error
-	checkValue = func(path string, val interface{}, typ string) error {
+	// checkValue validates val against typ; decl is the annotation declaring typ.
+	var checkValue func(path string, val interface{}, typ string, decl diag.Pos) error
+	checkValue = func(path string, val interface{}, typ string, decl diag.Pos) error {
 		if strings.HasPrefix(typ, "map[") {
 			child := deriveTypeName(typ)
 			if m, ok := val.(map[string]interface{}); ok {
@@ -940,7 +1033,7 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 				}
 				sort.Strings(keys)
 				for _, k := range keys {
-					if err := checkValue(path+"."+k, m[k], child); err != nil {
+					if err := checkValue(path+"."+k, m[k], child, decl); err != nil {
 						return err
 					}
 				}
@@ -952,7 +1045,7 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 			child := deriveTypeName(typ)
 			if arr, ok := val.([]interface{}); ok {
 				for i, v := range arr {
-					if err := checkValue(fmt.Sprintf("%s[%d]", path, i), v, child); err != nil {
+					if err := checkValue(fmt.Sprintf("%s[%d]", path, i), v, child, decl); err != nil {
 						return err
 					}
 				}
@@ -961,7 +1054,7 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 		}
 
 		if strings.HasPrefix(typ, "*") {
-			return checkValue(path, val, strings.TrimPrefix(typ, "*"))
+			return checkValue(path, val, strings.TrimPrefix(typ, "*"), decl)
 		}
 
 		base := deriveTypeName(typ)
@@ -976,7 +1069,7 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 			if knownTypes[base] {
 				return nil
 			}
-			return fmt.Errorf("type '%s' referenced at '%s' has no schema", base, path)
+			return diag.Errorf(decl.Find("{").Find(base), "type '%s' referenced at '%s' has no schema", base, path)
 		}
 
 		valMap, ok := val.(map[string]interface{})
@@ -999,9 +1092,9 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 			v := valMap[k]
 			fm, exists := allowed[k]
 			if !exists {
-				return fmt.Errorf("field '%s.%s' is not defined in schema", path, k)
+				return diag.Errorf(meta.ValuePos[path+"."+k], "field '%s.%s' is not defined in schema", path, k)
 			}
-			if err := checkValue(path+"."+k, v, fm.Type); err != nil {
+			if err := checkValue(path+"."+k, v, fm.Type, fm.Pos); err != nil {
 				return err
 			}
 		}
@@ -1018,17 +1111,16 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 		v := values[k]
 		pm, exists := paramMap[k]
 		if !exists {
-			// Check if this key is covered by dotted path params (e.g., "postgres" covered by "postgres.version")
-			if !dottedPathRoots[k] {
-				return fmt.Errorf("parameter '%s' is not defined in schema", k)
-			}
+			return diag.Errorf(meta.ValuePos[k], "parameter '%s' is not defined in schema", k)
+		}
+		if pm.Implicit {
 			// NOTE: Dotted path roots (e.g., "postgres" when "postgres.version" is defined)
 			// skip deep validation. This means extra fields in values.yaml under these roots
 			// won't cause validation errors. This is intentional for umbrella charts where
 			// subcharts may have additional fields not explicitly documented.
 			continue
 		}
-		if err := checkValue(k, v, pm.TypeOriginal); err != nil {
+		if err := checkValue(k, v, pm.TypeOriginal, pm.Pos); err != nil {
 			return err
 		}
 	}
@@ -1036,37 +1128,62 @@ func validateValues(params []ParamMeta, typeFields map[string][]FieldMeta, value
 }
 
 func UpdateParametersSection(valuesPath, readmePath string) error {
-	vals, err := createValuesObject(valuesPath)
+	content, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(readmePath, content, 0644)
+}
+
+// RenderParametersSection returns the README at readmePath with its
+// Parameters section regenerated from valuesPath, without writing it.
+func RenderParametersSection(valuesPath, readmePath string, opts openapi.ParseOptions) ([]byte, error) {
+	values, err := os.ReadFile(valuesPath)
+	if err != nil {
+		return nil, fmt.Errorf("read values: %w", err)
+	}
+	readme, err := os.ReadFile(readmePath)
+	if err != nil {
+		return nil, fmt.Errorf("read README: %w", err)
+	}
+	rows, err := openapi.ParseBytes(valuesPath, values, opts)
+	if err != nil {
+		return nil, fmt.Errorf("parse comments: %w", err)
+	}
+	return Render(openapi.Build(rows), valuesPath, values, readme)
+}
+
+// Render returns readme with its Parameters section regenerated from the
+// annotation tree root of the values file; valuesPath is only used in error
+// positions.
+func Render(root *openapi.Node, valuesPath string, values, readme []byte) ([]byte, error) {
+	vals, err := valuesObject(values)
 	if err != nil {
-		return fmt.Errorf("read values: %w", err)
+		return nil, fmt.Errorf("read values: %w", err)
 	}
-	meta, err := parseMetadataComments(valuesPath)
+	meta, err := newMeta(root, valuesPath, values)
 	if err != nil {
-		return fmt.Errorf("parse comments: %w", err)
+		return nil, fmt.Errorf("read values: %w", err)
 	}
-	combine(vals)
+	r := newRenderer(meta, vals)
 
 	params := []ParamMeta{}
 	for _, s := range meta.Sections {
 		params = append(params, s.Parameters...)
 	}
 
-	if err := validateValues(params, typeFields, vals, meta.KnownTypes); err != nil {
-		return fmt.Errorf("validate values: %w", err)
+	if err := validateValues(params, vals, meta); err != nil {
+		return nil, fmt.Errorf("validate values: %w", err)
 	}
 
 	var sb strings.Builder
 	for _, s := range meta.Sections {
-		sb.WriteString(renderSection(s))
+		sb.WriteString(r.renderSection(s))
 		sb.WriteString("\n")
 	}
 	newContent := sb.String()
 
-	contentBytes, err := os.ReadFile(readmePath)
-	if err != nil {
-		return fmt.Errorf("read README: %w", err)
-	}
-	lines := strings.Split(string(contentBytes), "\n")
+	lines := strings.Split(string(readme), "\n")
 	start, end := -1, len(lines)
 	re := regexp.MustCompile(`^(##+) Parameters`)
 	level := ""
@@ -1078,7 +1195,7 @@ func UpdateParametersSection(valuesPath, readmePath string) error {
 		}
 	}
 	if start == -1 {
-		return fmt.Errorf("Parameters section not found")
+		return nil, fmt.Errorf("Parameters section not found")
 	}
 	sameLevel := regexp.MustCompile("^" + level + "[^#]")
 	for i := start; i < len(lines); i++ {
@@ -1090,7 +1207,7 @@ func UpdateParametersSection(valuesPath, readmePath string) error {
 	newLines := append([]string{}, lines[:start]...)
 	newLines = append(newLines, strings.Split(newContent, "\n")...)
 	newLines = append(newLines, lines[end:]...)
-	return os.WriteFile(readmePath, []byte(strings.Join(newLines, "\n")), 0644)
+	return []byte(strings.Join(newLines, "\n")), nil
 }
 
 func defaultValueForType(t string) string {
@@ -1112,6 +1229,8 @@ func defaultValueForType(t string) string {
 		return "`0`"
 	case base == "bool":
 		return "`false`"
+	case openapi.UnionMembers(base) != nil:
+		return "`null`"
 	default:
 		return "`{}`"
 	}
@@ -3,8 +3,10 @@ package readme
 import (
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
 	"github.com/stretchr/testify/require"
 )
 
@@ -33,12 +35,12 @@ func renderTableFromValues(t *testing.T, valuesYaml string) string {
 	if err != nil {
 		t.Fatal(err)
 	}
-	combine(vals)
+	r := newRenderer(meta, vals)
 	var params []ParamMeta
 	for _, s := range meta.Sections {
 		params = append(params, s.Parameters...)
 	}
-	rendered := buildParamsToRender(params)
+	rendered := r.buildParamsToRender(params)
 	return markdownTable(rendered)
 }
 
@@ -176,12 +178,12 @@ postgresql: {}
 }
 
 func TestNormalizeQuantityTypes(t *testing.T) {
-	require.Equal(t, "quantity", normalizeType("quantity"))
-	require.Equal(t, "*quantity", normalizeType("*quantity"))
+	require.Equal(t, "quantity", (&renderer{}).normalizeType("quantity"))
+	require.Equal(t, "*quantity", (&renderer{}).normalizeType("*quantity"))
 }
 
 func TestStringEnumStripped(t *testing.T) {
-	if normalizeType("string enum:\"nano,micro\"") != "string" {
+	if (&renderer{}).normalizeType("string enum:\"nano,micro\"") != "string" {
 		t.Errorf("expected enum type to be stripped to string")
 	}
 }
@@ -399,7 +401,7 @@ foo:
 	for _, s := range meta.Sections {
 		params = append(params, s.Parameters...)
 	}
-	err := validateValues(params, typeFields, vals, meta.KnownTypes)
+	err := validateValues(params, vals, meta)
 	if err == nil || !strings.Contains(err.Error(), "foo.db.sie") {
 		t.Errorf("expected error about unknown field foo.db.sie, got: %v", err)
 	}
@@ -470,7 +472,7 @@ func TestNormalizeTypePrimitives(t *testing.T) {
 	}
 
 	for in, want := range cases {
-		if got := normalizeType(in); got != want {
+		if got := (&renderer{}).normalizeType(in); got != want {
 			t.Fatalf("normalizeType(%q) = %q, want %q", in, got, want)
 		}
 	}
@@ -570,7 +572,7 @@ nodeGroups:
 		params = append(params, s.Parameters...)
 	}
 
-	require.NoError(t, validateValues(params, typeFields, vals, meta.KnownTypes))
+	require.NoError(t, validateValues(params, vals, meta))
 
 	// README table renders `{...}` for map[string]object
 	table := renderTableFromValues(t, yamlContent)
@@ -604,7 +606,7 @@ config:
 		params = append(params, s.Parameters...)
 	}
 
-	err = validateValues(params, typeFields, vals, meta.KnownTypes)
+	err = validateValues(params, vals, meta)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "type 'Merge' referenced at 'config.merge' has no schema")
 }
@@ -634,7 +636,7 @@ config:
 		params = append(params, s.Parameters...)
 	}
 
-	require.NoError(t, validateValues(params, typeFields, vals, meta.KnownTypes))
+	require.NoError(t, validateValues(params, vals, meta))
 }
 
 func TestSourceUploadSchemaFromTopBlock(t *testing.T) {
@@ -680,7 +682,7 @@ storageClass: replicated
 	}
 
 	// validate should pass: 'source' type schema is known
-	require.NoError(t, validateValues(params, typeFields, vals, meta.KnownTypes))
+	require.NoError(t, validateValues(params, vals, meta))
 
 	// rendered table should show object for emptyobject and nested fields
 	table := renderTableFromValues(t, yamlContent)
@@ -966,3 +968,470 @@ presets:
 	require.NotContains(t, table, "`[]object`", "array-of-enums should not be []object")
 }
 
+
+func TestValidationErrorsHavePositions(t *testing.T) {
+	yamlContent := `## @typedef {struct} Foo - Foo
+## @field {string} size - Size
+
+## @param {Foo} foo - Foo
+foo:
+  sie: 10Gi
+`
+	path := writeTempFile(t, yamlContent)
+	defer os.Remove(path)
+	vals, err := createValuesObject(path)
+	require.NoError(t, err)
+	meta, err := parseMetadataComments(path)
+	require.NoError(t, err)
+	require.Equal(t, 4, meta.Sections[0].Parameters[0].Pos.Line)
+	require.Equal(t, 2, meta.TypeFields["Foo"][0].Pos.Line)
+
+	var params []ParamMeta
+	for _, s := range meta.Sections {
+		params = append(params, s.Parameters...)
+	}
+	err = validateValues(params, vals, meta)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), path+":6:3: field 'foo.sie' is not defined in schema")
+	require.Contains(t, err.Error(), "  sie: 10Gi\n      ^")
+}
+
+// TestRenderConcurrently renders two unrelated values files in parallel; each
+// render must only see its own types and values.
+func TestRenderConcurrently(t *testing.T) {
+	a := `
+## @enum {string} Size - Size
+## @value small
+## @value large
+## @param {Size} size - Size
+size: small
+`
+	b := `
+## @typedef {struct} Size - Size as a struct
+## @field {int} cpu - CPU
+## @param {Size} size - Size
+size:
+  cpu: 2
+`
+	wantA := renderTableFromValues(t, a)
+	wantB := renderTableFromValues(t, b)
+	require.Contains(t, wantA, "`small`")
+	require.Contains(t, wantB, "`size.cpu`")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() { defer wg.Done(); require.Equal(t, wantA, renderTableFromValues(t, a)) }()
+		go func() { defer wg.Done(); require.Equal(t, wantB, renderTableFromValues(t, b)) }()
+	}
+	wg.Wait()
+}
+
+func TestConstraintsAndEnumValuesInDescription(t *testing.T) {
+	yamlContent := `
+## @enum {string} Size - Size preset
+## @value small
+## @value large
+
+## @typedef {struct} Db - Database
+## @field {string} name - Name
+## @pattern ^(a|b)+$
+## @maxLength 10
+
+## @param {int} replicas - Replicas
+## @minimum 1
+## @maximum 5
+## @exclusiveMaximum
+## @param {[]Size} sizes
+## @minItems 1
+## @param {Db} db - Database
+replicas: 2
+sizes: [small]
+db:
+  name: ab
+`
+	table := renderTableFromValues(t, yamlContent)
+	require.Contains(t, table, "| Replicas (minimum 1, exclusive maximum 5) |")
+	require.Contains(t, table, "| (one of `small`, `large`, min items 1)    |")
+	require.Contains(t, table, "| Name (max length 10, pattern `^(a\\|b)+$`) |")
+}
+
+func TestAnnotationDefaultsMatchSchema(t *testing.T) {
+	yamlContent := `
+## @typedef {struct} Db - Database
+## @field {string} user=admin - Unquoted string default
+## @field {int} port=5432 - Port
+
+## @param {string} host="db.local" - Host
+## @param {int} workers=4 - Workers
+## @param {Db} db - Database
+db: {}
+`
+	table := renderTableFromValues(t, yamlContent)
+	require.Regexp(t, "`host`.*\\|\\s*`db.local`", table)
+	require.Regexp(t, "`workers`.*\\|\\s*`4`", table)
+	require.Regexp(t, "`db.user`.*\\|\\s*`admin`", table)
+	require.Regexp(t, "`db.port`.*\\|\\s*`5432`", table)
+}
+
+func TestSectionsFollowAnnotations(t *testing.T) {
+	yamlContent := `
+## @param {int} a - A
+## @section First
+## @param {int} b - B
+## @section Second
+## @param {int} c - C
+a: 1
+b: 2
+c: 3
+`
+	path := writeTempFile(t, yamlContent)
+	defer os.Remove(path)
+
+	meta, err := parseMetadataComments(path)
+	require.NoError(t, err)
+	var names []string
+	for _, s := range meta.Sections {
+		names = append(names, s.Name+":"+s.Parameters[0].Name)
+	}
+	require.Equal(t, []string{"Parameters:a", "First:b", "Second:c"}, names)
+}
+
+func TestDocBlocksRenderedBelowTable(t *testing.T) {
+	yamlContent := `## @section Users
+
+## @typedef {struct} User - User
+## @field {string} password - Password
+## of the user
+##
+## Generated when empty.
+
+## @param {map[string]User} users - Users configuration
+##
+## Example:
+## ` + "```yaml" + `
+## users:
+##   alice: {}
+## ` + "```" + `
+users: {}
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `users[name].password` | Password of the user | `string`            | `\"\"`  |")
+	require.Contains(t, string(out), "<details>\n<summary><code>users</code></summary>\n\nExample:\n```yaml\nusers:\n  alice: {}\n```\n\n</details>\n")
+	require.Contains(t, string(out), "<summary><code>users[name].password</code></summary>\n\nGenerated when empty.\n")
+}
+
+func TestExamplesRenderedBelowTable(t *testing.T) {
+	yamlContent := `## @param {map[string]int} ports - Ports
+## Listening ports.
+##
+## Only TCP is supported.
+## @example {"http": 80}
+## @example
+##   https: 443
+ports: {}
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "<summary><code>ports</code></summary>\n\nOnly TCP is supported.\n\nExample:\n\n```yaml\n{\"http\": 80}\n```\n\nExample:\n\n```yaml\nhttps: 443\n```\n\n</details>\n")
+}
+
+func TestDottedParamsRenderLeafRows(t *testing.T) {
+	yamlContent := `## @section Subcharts
+## @param {string} postgres.version - Postgres version
+## @param {int} postgres.persistence.size - Volume size
+## @param {string} backups[].name - Backup name
+postgres:
+  version: "16"
+  persistence:
+    size: 10
+  undocumented: allowed for subcharts
+backups: []
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "### Subcharts\n\n"+
+		"| Name                        | Description      | Type     | Value | Required |\n"+
+		"| --------------------------- | ---------------- | -------- | ----- | -------- |\n"+
+		"| `postgres.version`          | Postgres version | `string` | `16`  | yes      |\n"+
+		"| `postgres.persistence.size` | Volume size      | `int`    | `10`  | yes      |\n"+
+		"| `backups[i].name`           | Backup name      | `string` | `\"\"`  | yes      |\n")
+}
+
+func TestQuotedNamesRender(t *testing.T) {
+	yamlContent := `## @section Addons
+## @param {bool} "cert-manager" - Cert manager
+## @param {string} "app.kubernetes.io/name" - App name
+cert-manager: true
+app.kubernetes.io/name: demo
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `cert-manager`           | Cert manager | `bool`   | `true` | yes      |\n")
+	require.Contains(t, string(out), "| `app.kubernetes.io/name` | App name     | `string` | `demo` | yes      |\n")
+}
+
+func TestRequiredColumn(t *testing.T) {
+	yamlContent := `## @typedef {struct} Db - Db
+## @field {string} host - Host
+## @required
+## @field {int} [port] - Port
+
+## @param {Db} db - Database
+## @param {[]string} tags - Tags
+db:
+  host: x
+tags: []
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| Name      | Description | Type       | Value | Required |\n"+
+		"| --------- | ----------- | ---------- | ----- | -------- |\n"+
+		"| `db`      | Database    | `object`   | `{}`  | yes      |\n"+
+		"| `db.host` | Host        | `string`   | `x`   | yes      |\n"+
+		"| `db.port` | Port        | `int`      | `0`   | no       |\n"+
+		"| `tags`    | Tags        | `[]string` | `[]`  | no       |\n")
+
+	// The column follows the policy, not the tag
+	plain := strings.Replace(yamlContent, "## @required\n", "", 1)
+	require.NoError(t, os.WriteFile(valuesPath, []byte(plain), 0o644))
+	out, err = RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `db.host` | Host        | `string`   | `x`   | yes      |\n")
+	out, err = RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{OptionalByDefault: true})
+	require.NoError(t, err)
+	require.NotContains(t, string(out), "Required")
+}
+
+func TestImmutableRule(t *testing.T) {
+	yamlContent := `## @typedef {struct} Disk - Disk
+## @field {string} image - Image
+## @immutable
+
+## @param {Disk} disk - Disk
+## @param {string} name - Name
+## @immutable
+## @maxLength 63
+disk:
+  image: ubuntu
+name: vm
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `disk.image` | Image (immutable)               | `string` | `ubuntu` | yes      |\n")
+	require.Contains(t, string(out), "| `name`       | Name (immutable, max length 63) | `string` | `vm`     | yes      |\n")
+}
+
+func TestConditionRules(t *testing.T) {
+	yamlContent := `## @param {bool} external - External access
+## @param {[]int} externalPorts - Ports
+## @requiredIf external=true
+## @visibleIf external=true
+external: false
+externalPorts: []
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `externalPorts` | Ports (required if `external=true`, shown if `external=true`) | `[]int` | `[]`    | no       |\n")
+}
+
+func TestUnionTypes(t *testing.T) {
+	yamlContent := `## @typedef {struct} Port - Port
+## @field {intOrString} targetPort - Target port
+
+## @param {[]Port} ports - Ports
+## @param {string|int} port - Port
+## @param {string | bool} tls - TLS
+## @param {*intOrString} [maxSurge] - Max surge
+ports:
+  - targetPort: http
+port: 8080
+tls: true
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `ports[i].targetPort` | Target port | `int\\|string`  | `null`  | yes      |\n")
+	require.Contains(t, string(out), "| `port`                | Port        | `int\\|string`  | `8080`  | yes      |\n")
+	require.Contains(t, string(out), "| `tls`                 | TLS         | `bool\\|string` | `true`  | yes      |\n")
+	require.Contains(t, string(out), "| `maxSurge`            | Max surge   | `*int\\|string` | `null`  | no       |\n")
+
+	for in, want := range map[string]string{
+		"intOrString":            "int|string",
+		"string|int32":           "int32|string",
+		"[]intOrString":          "[]int|string",
+		"map[string]string|bool": "map[string]bool|string",
+		"*intOrString":           "*int|string",
+	} {
+		require.Equal(t, want, (&renderer{}).normalizeType(in), in)
+	}
+}
+
+func TestUnionTypedef(t *testing.T) {
+	yamlContent := `## @typedef {struct} S3Target - S3 bucket
+## @field {string} bucket - Bucket name
+## @typedef {struct} GCSTarget - GCS bucket
+## @field {string} bucket - Bucket name
+
+## @union {BackupTarget} - Backup target
+## @variant s3 S3Target
+## @variant gcs GCSTarget - Google Cloud Storage
+
+## @param {BackupTarget} target - Where backups go
+target:
+  type: s3
+  s3:
+    bucket: backups
+`
+	render := func(content string, opts openapi.ParseOptions) string {
+		valuesPath := writeTempFile(t, content)
+		defer os.Remove(valuesPath)
+		readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+		defer os.Remove(readmePath)
+
+		out, err := RenderParametersSection(valuesPath, readmePath, opts)
+		require.NoError(t, err)
+		return string(out)
+	}
+
+	// With nothing else required, the discriminator adds no Required column
+	optional := openapi.ParseOptions{OptionalByDefault: true}
+	out := render(yamlContent, optional)
+	require.NotContains(t, out, "Required")
+	require.Contains(t, out, "| `target.type`       | Selects the variant (one of `s3`, `gcs`)   | `string`  | `s3`      |\n")
+
+	out = render(strings.Replace(yamlContent, "## @param {BackupTarget} target - Where backups go\n", "## @param {BackupTarget} target - Where backups go\n## @required\n", 1), optional)
+	require.Contains(t, out, "| `target`            | Where backups go                           | `object`  | `{}`      | yes      |\n")
+	require.Contains(t, out, "| `target.s3.bucket`  | Bucket name                                | `string`  | `backups` | no       |\n")
+
+	// Under the default policy, fields are required unless optional
+	out = render(yamlContent, openapi.ParseOptions{})
+	require.Contains(t, out, "| `target.type`       | Selects the variant (one of `s3`, `gcs`)   | `string`  | `s3`      | yes      |\n")
+	require.Contains(t, out, "| `target.s3`         | S3 bucket (shown if `type=s3`)             | `*object` | `null`    | no       |\n")
+	require.Contains(t, out, "| `target.s3.bucket`  | Bucket name                                | `string`  | `backups` | yes      |\n")
+	require.Contains(t, out, "| `target.gcs`        | Google Cloud Storage (shown if `type=gcs`) | `*object` | `null`    | no       |\n")
+	require.Contains(t, out, "| `target.gcs.bucket` | Bucket name                                | `string`  | `\"\"`      | yes      |\n")
+}
+
+func TestEmbeddedTypedef(t *testing.T) {
+	yamlContent := `## @typedef {struct} Base - Common settings
+## @field {bool} enabled - Enable the component
+## @field {string} [storageClass] - StorageClass used to store the data
+
+## @typedef {struct} Replica - Replica settings @extends Base
+## @field {int} replicas - Number of replicas
+
+## @param {[]Replica} replicas - Replicas
+replicas:
+  - enabled: true
+    replicas: 2
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `replicas[i].enabled`      | Enable the component                | `bool`     | `false` | yes      |\n")
+	require.Contains(t, string(out), "| `replicas[i].storageClass` | StorageClass used to store the data | `string`   | `\"\"`    | no       |\n")
+	require.Contains(t, string(out), "| `replicas[i].replicas`     | Number of replicas                  | `int`      | `0`     | yes      |\n")
+}
+
+func TestTypeAliases(t *testing.T) {
+	yamlContent := `## @typedef {string} Hostname - DNS name
+## @pattern ^[a-z.]+$
+## @typedef {[]Hostname} Hostnames - DNS names
+## @uniqueItems
+## @typedef {struct} Node - Node
+## @field {Hostname} host - Host of the node
+## @maxLength 10
+## @typedef {[]Node} Nodes - Nodes
+
+## @param {Hostnames} replicas - Replica hosts
+## @param {Nodes} nodes - Nodes
+replicas: [a, b]
+nodes:
+  - host: db
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `replicas`      | Replica hosts (unique)                                | `[]string` | `[a, b]` | no       |\n")
+	require.Contains(t, string(out), "| `nodes`         | Nodes                                                 | `[]object` | `[...]`  | no       |\n")
+	require.Contains(t, string(out), "| `nodes[i].host` | Host of the node (max length 10, pattern `^[a-z.]+$`) | `string`   | `\"\"`     | yes      |\n")
+}
+
+func TestNestedTypedefFields(t *testing.T) {
+	yamlContent := `## @typedef {struct} Postgresql - Postgres settings
+## @field {string} version - Version
+## @field {struct} backup - Backup config
+## @field {string} backup.schedule="0 2 * * *" - Cron schedule
+## @field {bool} [backup.enabled] - Enable backups
+## @field {[]struct} users - Users
+## @field {string} users[].name - User name
+
+## @param {Postgresql} postgres - Postgres
+postgres:
+  version: "16"
+  backup:
+    schedule: "0 2 * * *"
+  users:
+    - name: app
+`
+	valuesPath := writeTempFile(t, yamlContent)
+	defer os.Remove(valuesPath)
+	readmePath := writeTempFile(t, "# Chart\n\n## Parameters\n")
+	defer os.Remove(readmePath)
+
+	out, err := RenderParametersSection(valuesPath, readmePath, openapi.ParseOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(out), "| `postgres.backup`          | Backup config  | `object`   | `{}`        | yes      |\n")
+	require.Contains(t, string(out), "| `postgres.backup.schedule` | Cron schedule  | `string`   | `0 2 * * *` | yes      |\n")
+	require.Contains(t, string(out), "| `postgres.backup.enabled`  | Enable backups | `bool`     | `false`     | no       |\n")
+	require.Contains(t, string(out), "| `postgres.users[i].name`   | User name      | `string`   | `\"\"`        | yes      |\n")
+}
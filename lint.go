@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cozystack/cozyvalues-gen/internal/config"
+	"github.com/cozystack/cozyvalues-gen/internal/lint"
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
+	"github.com/spf13/pflag"
+)
+
+// runLint implements `cozyvalues-gen lint [flags] [values.yaml ...]` and
+// returns the process exit code.
+func runLint(args []string) int {
+	fs := pflag.NewFlagSet("lint", pflag.ContinueOnError)
+	rules := fs.StringArray("rule", nil, "set rule severity, e.g. --rule missing-description=off (repeatable)")
+	allow := fs.StringSlice("allow-tag", nil, "accept an @tag owned by another tool (repeatable)")
+	optional := fs.Bool("optional-by-default", false, "make params and fields without @required optional")
+	list := fs.Bool("list-rules", false, "print available rules and exit")
+	if err := fs.Parse(args); err != nil {
+		if err == pflag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if *list {
+		for _, r := range lint.Rules {
+			fmt.Printf("%-22s %-8s %s\n", r.Name, r.Severity, r.Doc)
+		}
+		return 0
+	}
+
+	cfg := lint.Config{}
+	for _, spec := range *rules {
+		name, sev, ok := strings.Cut(spec, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "lint: --rule %q: want name=off|warning|error\n", spec)
+			return 2
+		}
+		s, err := lint.ParseSeverity(sev)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lint: --rule %q: %v\n", spec, err)
+			return 2
+		}
+		cfg[strings.TrimSpace(name)] = s
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return 2
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"values.yaml"}
+	}
+
+	var errs, warns int
+	for _, f := range files {
+		// Rules from the configuration file apply unless overridden by --rule.
+		fileCfg, popts := lint.Config{}, openapi.ParseOptions{AllowTags: *allow, OptionalByDefault: *optional}
+		cf, err := config.Discover(filepath.Dir(f))
+		if err != nil {
+			fmt.Printf("config: %v\n", err)
+			errs++
+			continue
+		}
+		if cf != nil {
+			s := cf.For(filepath.Dir(f))
+			for name, sev := range s.Lint.Rules {
+				fileCfg[name] = sev
+			}
+			popts.AllowTags = append(popts.AllowTags, s.AllowTags...)
+			popts.TypeAliases = s.Types
+			if s.OptionalByDefault != nil && !fs.Changed("optional-by-default") {
+				popts.OptionalByDefault = *s.OptionalByDefault
+			}
+		}
+		for name, sev := range cfg {
+			fileCfg[name] = sev
+		}
+
+		in, err := lint.Load(f, popts)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			errs++
+			continue
+		}
+		for _, d := range lint.Run(in, fileCfg) {
+			fmt.Println(d)
+			if d.Severity == lint.Error {
+				errs++
+			} else {
+				warns++
+			}
+		}
+	}
+	fmt.Printf("%d error(s), %d warning(s)\n", errs, warns)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
@@ -2,46 +2,87 @@
 //
 //	from “## @param / @field” comments inside a values.yaml file.
 //
-// Controller-gen ≥ v0.16 is required for CRD generation.
+// Schemas and CRDs are rendered natively from the annotation tree; the
+// legacy controller-gen pipeline stays available via --controller-gen.
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/cozystack/cozyvalues-gen/internal/openapi"
 	"github.com/cozystack/cozyvalues-gen/internal/readme"
+	"github.com/cozystack/cozyvalues-gen/pkg/cozyvalues"
 	"github.com/spf13/pflag"
 	sigyaml "sigs.k8s.io/yaml"
 )
 
 var Version = "dev"
 
-var (
-	inValues    string
+// options are the generator settings shared by single-chart and batch runs.
+type options struct {
 	module      string
 	groupName   string
 	versionName string
-	outGo       string
-	outCRD      string
-	outSchema   string
-	outReadme   string
+	useCG       bool
+	allowTags   []string
+	checkOnly   bool
+	optional    bool              // --optional-by-default
+	typeAliases map[string]string // from the configuration file
+}
+
+// job is one values file and the outputs rendered from it; empty output
+// paths are skipped.
+type job struct {
+	values    string
+	outGo     string
+	outCRD    string
+	outSchema string
+	outReadme string
+}
+
+var (
+	opts      options
+	cli       job
+	modelDump string
 )
 
+// addOptionFlags registers the flags backing options on fs.
+func addOptionFlags(fs *pflag.FlagSet, o *options) {
+	fs.StringVarP(&o.module, "module", "m", "values", "package name")
+	fs.StringVar(&o.groupName, "group-name", "apps.cozystack.io", "API group name for +groupName marker")
+	fs.StringVar(&o.versionName, "version-name", "v1alpha1", "API version for +versionName marker")
+	fs.StringSliceVar(&o.allowTags, "allow-tag", nil, "accept an @tag owned by another tool (repeatable)")
+	fs.BoolVar(&o.checkOnly, "check", false, "render outputs in memory and fail with a diff if any file on disk is stale; nothing is written")
+	fs.BoolVar(&o.optional, "optional-by-default", false, "make params and fields without @required optional")
+	fs.BoolVar(&o.useCG, "controller-gen", false, "render CRD and schema through controller-gen (requires a Go toolchain)")
+}
+
 func init() {
 	pflag.BoolP("version", "V", false, "print version and exit")
-	pflag.StringVarP(&inValues, "values", "v", "values.yaml", "annotated Helm values.yaml")
-	pflag.StringVarP(&module, "module", "m", "values", "package name")
-	pflag.StringVar(&groupName, "group-name", "apps.cozystack.io", "API group name for +groupName marker")
-	pflag.StringVar(&versionName, "version-name", "v1alpha1", "API version for +versionName marker")
-	pflag.StringVarP(&outGo, "debug-go", "g", "", "output *.go file")
-	pflag.StringVarP(&outCRD, "debug-crd", "c", "", "output CRD YAML")
-	pflag.StringVarP(&outSchema, "schema", "s", "", "output values.schema.json")
-	pflag.StringVarP(&outReadme, "readme", "r", "", "update README.md Parameters section")
+	pflag.StringVarP(&cli.values, "values", "v", "values.yaml", "annotated Helm values.yaml")
+	pflag.StringVarP(&cli.outGo, "debug-go", "g", "", "output *.go file")
+	pflag.StringVarP(&cli.outCRD, "debug-crd", "c", "", "output CRD YAML")
+	pflag.StringVarP(&cli.outSchema, "schema", "s", "", "output values.schema.json")
+	pflag.StringVarP(&cli.outReadme, "readme", "r", "", "update README.md Parameters section")
+	pflag.StringVar(&modelDump, "dump-model", "", "print the parsed annotation model in the given format (json) and exit")
+	addOptionFlags(pflag.CommandLine, &opts)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		case "batch":
+			os.Exit(runBatch(os.Args[2:]))
+		}
+	}
+
 	pflag.Parse()
 
 	if v, _ := pflag.CommandLine.GetBool("version"); v {
@@ -49,15 +90,82 @@ func main() {
 		os.Exit(0)
 	}
 
-	rows, err := openapi.Parse(inValues)
+	if err := applyConfig(pflag.CommandLine, &opts, &cli, filepath.Dir(cli.values)); err != nil {
+		fmt.Printf("config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if modelDump != "" {
+		if err := dumpModel(&opts, cli.values, modelDump, os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	upToDate, err := generate(&opts, cli, os.Stdout)
 	if err != nil {
-		fmt.Printf("parse: %v\n", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
+	if !upToDate {
+		os.Exit(1)
+	}
+}
+
+// dumpModel writes the model parsed from the values file to w.
+func dumpModel(o *options, values, format string, w io.Writer) error {
+	if format != "json" {
+		return fmt.Errorf("dump-model: unsupported format %q (want json)", format)
+	}
+	data, err := os.ReadFile(values)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	v, err := cozyvalues.Parse(data, cozyvalues.Options{
+		Filename:          values,
+		Module:            o.module,
+		GroupName:         o.groupName,
+		VersionName:       o.versionName,
+		AllowTags:         o.allowTags,
+		TypeAliases:       o.typeAliases,
+		OptionalByDefault: o.optional,
+	})
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	out, err := json.MarshalIndent(v.Model, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", out)
+	return err
+}
+
+// generate renders every output of j and reports progress to w. It returns
+// false when --check found a stale output.
+func generate(o *options, j job, w io.Writer) (bool, error) {
+	rows, err := openapi.ParseWithOptions(j.values, openapi.ParseOptions{
+		AllowTags:         o.allowTags,
+		TypeAliases:       o.typeAliases,
+		OptionalByDefault: o.optional,
+	})
+	if err != nil {
+		return false, fmt.Errorf("parse: %w", err)
+	}
 	tree := openapi.Build(rows)
 
+	// Type-check values and inline defaults before they are merged.
+	yamlRaw, _ := os.ReadFile(j.values)
+	if errs := openapi.Check(tree, j.values, yamlRaw); len(errs) > 0 {
+		all := make([]error, len(errs))
+		for i, e := range errs {
+			all[i] = e // positioned in the values file
+		}
+		return false, errors.Join(all...)
+	}
+
 	// Pull defaults directly from YAML.
-	yamlRaw, _ := os.ReadFile(inValues)
 	var yamlRoot map[string]interface{}
 	_ = sigyaml.Unmarshal(yamlRaw, &yamlRoot)
 	openapi.PopulateDefaults(tree, yamlRoot, tree.Child)
@@ -68,55 +176,80 @@ func main() {
 	//}
 
 	var (
-		tmpdir     string
 		goFilePath string
+		upToDate   = true
 	)
 
-	// Generate Go files only if required
-	if outGo != "" || outCRD != "" || outSchema != "" {
-		var genErr error
-		tmpdir, goFilePath, genErr = openapi.WriteGeneratedGoAndStub(tree, module, groupName, versionName)
+	// Scaffold a Go module only for the legacy controller-gen pipeline
+	if o.useCG && (j.outCRD != "" || j.outSchema != "") {
+		tmpdir, path, genErr := openapi.WriteGeneratedGoAndStub(tree, o.module, o.groupName, o.versionName)
 		if genErr != nil {
-			fmt.Printf("write generated: %v\n", genErr)
+			fmt.Fprintf(w, "write generated: %v\n", genErr)
 		}
 		defer os.RemoveAll(tmpdir)
+		goFilePath = path
 	}
 
-	if outGo != "" {
-		code, _ := os.ReadFile(goFilePath)
-		_ = os.MkdirAll(filepath.Dir(outGo), 0o755)
-		_ = os.WriteFile(outGo, code, 0o644)
-		fmt.Printf("write Go structs (possibly unformatted): %s\n", outGo)
+	if j.outGo != "" {
+		code, raw, genErr := openapi.NewGen(o.module, o.groupName, o.versionName).Generate(tree)
+		if genErr != nil {
+			fmt.Fprintf(w, "write generated: %v\n", genErr)
+			code = raw
+		}
+		ok, err := emit(w, o.checkOnly, j.outGo, code, "write Go structs (possibly unformatted)")
+		if err != nil {
+			return false, err
+		}
+		upToDate = ok && upToDate
 	}
 
 	var crdBytes []byte
-	if outCRD != "" || outSchema != "" {
-		crdBytes, err = openapi.CG(filepath.Dir(goFilePath))
+	if j.outCRD != "" || j.outSchema != "" {
+		if o.useCG {
+			crdBytes, err = openapi.CG(filepath.Dir(goFilePath))
+		} else {
+			crdBytes, err = openapi.GenerateCRD(tree, o.groupName, o.versionName)
+		}
 		if err != nil {
-			fmt.Printf("controller-gen: %v\n", err)
-			os.Exit(1)
+			return false, fmt.Errorf("generate CRD: %w", err)
 		}
 	}
 
-	if outCRD != "" {
-		_ = os.MkdirAll(filepath.Dir(outCRD), 0o755)
-		_ = os.WriteFile(outCRD, crdBytes, 0o644)
-		fmt.Printf("write CRD resource: %s\n", outCRD)
+	if j.outCRD != "" {
+		ok, err := emit(w, o.checkOnly, j.outCRD, crdBytes, "write CRD resource")
+		if err != nil {
+			return false, err
+		}
+		upToDate = ok && upToDate
 	}
 
-	if outSchema != "" {
-		if err := openapi.WriteValuesSchemaWithOrder(crdBytes, outSchema, tree); err != nil {
-			fmt.Printf("values schema: %v\n", err)
-			os.Exit(1)
+	if j.outSchema != "" {
+		schema, err := openapi.ValuesSchema(crdBytes, tree)
+		if err != nil {
+			return false, fmt.Errorf("values schema: %w", err)
 		}
-		fmt.Printf("write JSON schema: %s\n", outSchema)
+		ok, err := emit(w, o.checkOnly, j.outSchema, schema, "write JSON schema")
+		if err != nil {
+			return false, err
+		}
+		upToDate = ok && upToDate
 	}
 
-	if outReadme != "" {
-		if err := readme.UpdateParametersSection(inValues, outReadme); err != nil {
-			fmt.Printf("README: %v\n", err)
-			os.Exit(1)
+	if j.outReadme != "" {
+		doc, err := os.ReadFile(j.outReadme)
+		if err != nil {
+			return false, fmt.Errorf("README: %w", err)
+		}
+		content, err := readme.Render(tree, j.values, yamlRaw, doc)
+		if err != nil {
+			return false, fmt.Errorf("README: %w", err)
 		}
-		fmt.Printf("update README parameters: %s\n", outReadme)
+		ok, err := emit(w, o.checkOnly, j.outReadme, content, "update README parameters")
+		if err != nil {
+			return false, err
+		}
+		upToDate = ok && upToDate
 	}
+
+	return upToDate, nil
 }
@@ -0,0 +1,149 @@
+// Package cozyvalues is the Go API of cozyvalues-gen. It parses an annotated
+// values.yaml from memory and renders Go types, a CRD, values.schema.json and
+// the README Parameters section into byte slices, without touching the disk
+// or any package-level state:
+//
+//	v, err := cozyvalues.Parse(data, cozyvalues.Options{Filename: "values.yaml"})
+//	if err != nil {
+//		return err
+//	}
+//	schema, err := v.Schema()
+//
+// Parse rejects the same files the command line does: unknown tags, values
+// that break their declared type and references to undeclared types.
+package cozyvalues
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
+	"github.com/cozystack/cozyvalues-gen/internal/readme"
+	sigyaml "sigs.k8s.io/yaml"
+)
+
+// Defaults used for the zero fields of Options; they match the CLI flags.
+const (
+	DefaultFilename    = "values.yaml"
+	DefaultModule      = "values"
+	DefaultGroupName   = "apps.cozystack.io"
+	DefaultVersionName = "v1alpha1"
+)
+
+// Options configure parsing and rendering. The zero value is usable.
+type Options struct {
+	// Filename is used in diagnostics only.
+	Filename string
+	// Module is the package name of the generated Go code.
+	Module string
+	// GroupName and VersionName are the API group and version of the CRD.
+	GroupName   string
+	VersionName string
+	// AllowTags lists @tags owned by other tools that are accepted as-is.
+	AllowTags []string
+	// TypeAliases maps custom type names to the type expressions they
+	// stand for, e.g. "Port" → "int32".
+	TypeAliases map[string]string
+	// OptionalByDefault makes every param and field without @required
+	// optional instead of only lists, maps, pointers and [name].
+	OptionalByDefault bool
+}
+
+func (o Options) withDefaults() Options {
+	set := func(s *string, def string) {
+		if *s == "" {
+			*s = def
+		}
+	}
+	set(&o.Filename, DefaultFilename)
+	set(&o.Module, DefaultModule)
+	set(&o.GroupName, DefaultGroupName)
+	set(&o.VersionName, DefaultVersionName)
+	return o
+}
+
+// Values is a parsed and checked values file. It is safe for concurrent use.
+type Values struct {
+	// Model is what the annotations declare, with defaults taken from the
+	// inline annotations and the values themselves.
+	Model *Model
+
+	opts Options
+	data []byte
+	tree *openapi.Node
+}
+
+// Parse parses and checks the annotated values file in data.
+func Parse(data []byte, opts Options) (*Values, error) {
+	opts = opts.withDefaults()
+	rows, err := openapi.ParseBytes(opts.Filename, data, openapi.ParseOptions{
+		AllowTags:         opts.AllowTags,
+		TypeAliases:       opts.TypeAliases,
+		OptionalByDefault: opts.OptionalByDefault,
+	})
+	if err != nil {
+		return nil, err
+	}
+	tree := openapi.Build(rows)
+
+	if errs := openapi.Check(tree, opts.Filename, data); len(errs) > 0 {
+		all := make([]error, len(errs))
+		for i, e := range errs {
+			all[i] = e
+		}
+		return nil, errors.Join(all...)
+	}
+
+	var root map[string]interface{}
+	if err := sigyaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("%s: %w", opts.Filename, err)
+	}
+	openapi.PopulateDefaults(tree, root, tree.Child)
+
+	return &Values{
+		Model: newModel(tree),
+		opts:  opts,
+		data:  data,
+		tree:  tree,
+	}, nil
+}
+
+// ParseReader is Parse reading the values file from r.
+func ParseReader(r io.Reader, opts Options) (*Values, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, opts)
+}
+
+// GoTypes renders the Go structs with their kubebuilder markers.
+func (v *Values) GoTypes() ([]byte, error) {
+	code, _, err := openapi.NewGen(v.opts.Module, v.opts.GroupName, v.opts.VersionName).Generate(v.tree)
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// CRD renders the CustomResourceDefinition controller-gen would produce for
+// the Go structs.
+func (v *Values) CRD() ([]byte, error) {
+	return openapi.GenerateCRD(v.tree, v.opts.GroupName, v.opts.VersionName)
+}
+
+// Schema renders values.schema.json.
+func (v *Values) Schema() ([]byte, error) {
+	crd, err := v.CRD()
+	if err != nil {
+		return nil, err
+	}
+	return openapi.ValuesSchema(crd, v.tree)
+}
+
+// Readme returns readmeDoc with its "## Parameters" section regenerated. The
+// section must already exist.
+func (v *Values) Readme(readmeDoc []byte) ([]byte, error) {
+	return readme.Render(v.tree, v.opts.Filename, v.data, readmeDoc)
+}
@@ -0,0 +1,161 @@
+package cozyvalues
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const sample = `## @enum {string} Size - Size preset
+## @value small
+## @value large
+
+## @typedef {struct} Db - Database
+## @field {string} host - Host
+## @field {int} [port]=5432 - Port
+## @minimum 1
+
+## @section Common parameters
+## @param {int} replicas - Number of replicas
+## @maximum 5
+## @example 3
+## @param {Size} size="small" - Size
+## @param {Db} db - Database
+replicas: 2
+size: small
+db:
+  host: localhost
+`
+
+func TestParseModel(t *testing.T) {
+	v, err := Parse([]byte(sample), Options{})
+	require.NoError(t, err)
+
+	m := v.Model
+	require.Len(t, m.Params, 3)
+	require.Equal(t, "replicas", m.Params[0].Name)
+	require.Equal(t, "2", m.Params[0].Default)
+	require.Equal(t, 5.0, *m.Params[0].Constraints.Maximum)
+	require.Equal(t, []string{"3"}, m.Params[0].Examples)
+	require.Equal(t, "values.yaml:11:4", m.Params[0].Pos.String())
+	require.Equal(t, `"small"`, m.Params[1].Default)
+	require.Equal(t, "Common parameters", m.Params[1].Section)
+
+	require.Len(t, m.Types, 2)
+	require.Equal(t, Type{
+		Name: "Size", Kind: Enum, Description: "Size preset", Base: "string",
+		Values: []string{"small", "large"}, Pos: Position{File: "values.yaml", Line: 1, Column: 4},
+	}, *m.Types[0])
+	db := m.Types[1]
+	require.Equal(t, Struct, db.Kind)
+	require.Len(t, db.Fields, 2)
+	require.Equal(t, "host", db.Fields[0].Name)
+	require.Equal(t, "localhost", db.Fields[0].Default)
+	require.Equal(t, "port", db.Fields[1].Name)
+	require.True(t, db.Fields[1].Optional)
+	require.True(t, db.Fields[0].Required)
+	require.False(t, db.Fields[1].Required)
+	require.Equal(t, "5432", db.Fields[1].Default)
+
+	_, err = json.Marshal(m)
+	require.NoError(t, err)
+}
+
+func TestParseModelAliases(t *testing.T) {
+	v, err := Parse([]byte(`## @typedef {[]string} Hosts - DNS names
+## @uniqueItems
+## @maxItems 3
+
+## @param {Hosts} hosts - Hosts
+hosts: [a]
+`), Options{})
+	require.NoError(t, err)
+
+	require.Len(t, v.Model.Types, 1)
+	hosts := v.Model.Types[0]
+	require.Equal(t, Alias, hosts.Kind)
+	require.Equal(t, "[]string", hosts.Base)
+	require.Equal(t, "set", hosts.ListType)
+	require.Equal(t, int64(3), *hosts.Constraints.MaxItems)
+	require.False(t, v.Model.Params[0].Required)
+}
+
+func TestParseOptionalByDefault(t *testing.T) {
+	v, err := Parse([]byte(sample), Options{OptionalByDefault: true})
+	require.NoError(t, err)
+	for _, p := range v.Model.Params {
+		require.True(t, p.Optional, p.Name)
+		require.False(t, p.Required, p.Name)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := Parse([]byte("## @param {int} a - A\n## @minimun 1\na: 1\n"), Options{Filename: "chart/values.yaml"})
+	require.ErrorContains(t, err, "chart/values.yaml:2:4: unknown annotation @minimun (did you mean @minimum?)")
+
+	_, err = Parse([]byte("## @param {int} a - A\n## @param {int} b - B\na: x\nb: y\n"), Options{})
+	require.ErrorContains(t, err, `a: expected an integer for {int}, got "x"`)
+	require.ErrorContains(t, err, `b: expected an integer for {int}, got "y"`)
+
+	v, err := Parse([]byte("## @param {Undeclared} a - A\n"), Options{})
+	require.NoError(t, err)
+	_, err = v.Schema()
+	require.Error(t, err)
+}
+
+func TestRenderOutputs(t *testing.T) {
+	v, err := ParseReader(strings.NewReader(sample), Options{Module: "demo"})
+	require.NoError(t, err)
+
+	code, err := v.GoTypes()
+	require.NoError(t, err)
+	require.Contains(t, string(code), "package demo")
+	require.Contains(t, string(code), "+groupName=apps.cozystack.io")
+
+	crd, err := v.CRD()
+	require.NoError(t, err)
+	require.Contains(t, string(crd), "kind: CustomResourceDefinition")
+
+	schema, err := v.Schema()
+	require.NoError(t, err)
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(schema, &doc))
+	require.Contains(t, doc["properties"], "replicas")
+
+	out, err := v.Readme([]byte("# Demo\n\n## Parameters\n\nold\n\n## License\n"))
+	require.NoError(t, err)
+	require.Contains(t, string(out), "### Common parameters")
+	require.Contains(t, string(out), "| `db.port`  | Port (minimum 1)               | `int`    | `5432`      |")
+	require.Contains(t, string(out), "| `size`     | Size (one of `small`, `large`) |")
+	require.NotContains(t, string(out), "old")
+	require.Contains(t, string(out), "## License")
+
+	_, err = v.Readme([]byte("# Demo\n"))
+	require.ErrorContains(t, err, "Parameters section not found")
+}
+
+func TestConcurrentRendering(t *testing.T) {
+	data, err := os.ReadFile("../../examples/postgres.yaml")
+	require.NoError(t, err)
+
+	v, err := Parse(data, Options{})
+	require.NoError(t, err)
+	want, err := v.Schema()
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := v.Schema()
+			require.NoError(t, err)
+			require.Equal(t, string(want), string(got))
+		}()
+	}
+	wg.Wait()
+}
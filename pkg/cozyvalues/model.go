@@ -0,0 +1,249 @@
+package cozyvalues
+
+import (
+	"github.com/cozystack/cozyvalues-gen/internal/diag"
+	"github.com/cozystack/cozyvalues-gen/internal/openapi"
+)
+
+// Model is the typed content of an annotated values file.
+type Model struct {
+	// Params are the @param annotations in declaration order.
+	Params []*Param `json:"params"`
+	// Types are the @typedef and @enum declarations in declaration order.
+	Types []*Type `json:"types,omitempty"`
+}
+
+// Param is a @param or a @field of a typedef.
+type Param struct {
+	Name string `json:"name"`
+	// Type is the type expression as written, after alias expansion,
+	// e.g. "[]*Port" or "map[string]quantity".
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	// Doc is the long-form documentation below the description, such as
+	// example blocks, with its line breaks and indentation.
+	Doc string `json:"doc,omitempty"`
+	// Default is the inline default or, failing that, the value from the
+	// values file, in its source form. HasDefault distinguishes an empty
+	// default from none.
+	Default    string `json:"default,omitempty"`
+	HasDefault bool   `json:"hasDefault,omitempty"`
+	Optional   bool   `json:"optional,omitempty"` // declared as [name] or optional by default
+	// Required is set when the value must be present, see @required.
+	Required bool `json:"required,omitempty"`
+	// Immutable is set when the value cannot change after install, see
+	// @immutable.
+	Immutable bool `json:"immutable,omitempty"`
+	// RequiredIf and VisibleIf are the path=value conditions of @requiredIf
+	// and @visibleIf.
+	RequiredIf string `json:"requiredIf,omitempty"`
+	VisibleIf  string `json:"visibleIf,omitempty"`
+	// ListType is the @listType of a list: set, map or atomic. ListMapKeys
+	// are the @listMapKey fields of a map list.
+	ListType    string   `json:"listType,omitempty"`
+	ListMapKeys []string `json:"listMapKeys,omitempty"`
+	// Implicit is set on the objects synthesized for the parents of dotted
+	// params such as postgres.version.
+	Implicit bool `json:"implicit,omitempty"`
+	// Section is the README @section of a param.
+	Section     string       `json:"section,omitempty"`
+	Constraints *Constraints `json:"constraints,omitempty"` // nil when there are none
+	// Examples are the @example values in source form.
+	Examples    []string     `json:"examples,omitempty"`
+	Validations []Validation `json:"validations,omitempty"`
+	Pos         Position     `json:"pos"`
+}
+
+// Validation is a @validate CEL rule of a param, field or typedef.
+type Validation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message,omitempty"`
+}
+
+// TypeKind tells a struct from an enum and an alias.
+type TypeKind string
+
+const (
+	Struct TypeKind = "struct"
+	Enum   TypeKind = "enum"
+	Alias  TypeKind = "alias"
+)
+
+// Type is a @typedef or an @enum.
+type Type struct {
+	Name        string   `json:"name"`
+	Kind        TypeKind `json:"kind"`
+	Description string   `json:"description,omitempty"`
+	Doc         string   `json:"doc,omitempty"`
+	// Fields of a struct, in declaration order, without those it inherits
+	// from Extends.
+	Fields []*Param `json:"fields,omitempty"`
+	// Extends are the struct types embedded with @extends or @embed.
+	Extends []string `json:"extends,omitempty"`
+	// Base type and values of an enum, or the type an alias names.
+	Base   string   `json:"base,omitempty"`
+	Values []string `json:"values,omitempty"`
+	// Constraints, list type and examples of an alias.
+	Constraints *Constraints `json:"constraints,omitempty"`
+	ListType    string       `json:"listType,omitempty"`
+	ListMapKeys []string     `json:"listMapKeys,omitempty"`
+	Examples    []string     `json:"examples,omitempty"`
+	// Implicit is set on structs synthesized for dotted params and on the
+	// enums of @union discriminators.
+	Implicit    bool         `json:"implicit,omitempty"`
+	Validations []Validation `json:"validations,omitempty"`
+	// Discriminator and Variants of a @union. Its Fields include the
+	// discriminator and a member per variant.
+	Discriminator string    `json:"discriminator,omitempty"`
+	Variants      []Variant `json:"variants,omitempty"`
+	Pos           Position  `json:"pos"`
+}
+
+// Variant is a @variant of a @union: the member Value holds a Type.
+type Variant struct {
+	Value       string   `json:"value"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Pos         Position `json:"pos"`
+}
+
+// Constraints are the validation annotations of a param or field.
+type Constraints struct {
+	Minimum          *float64 `json:"minimum,omitempty"`
+	Maximum          *float64 `json:"maximum,omitempty"`
+	ExclusiveMinimum bool     `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum bool     `json:"exclusiveMaximum,omitempty"`
+	MinLength        *int64   `json:"minLength,omitempty"`
+	MaxLength        *int64   `json:"maxLength,omitempty"`
+	Pattern          string   `json:"pattern,omitempty"`
+	MinItems         *int64   `json:"minItems,omitempty"`
+	MaxItems         *int64   `json:"maxItems,omitempty"`
+	MinProperties    *int64   `json:"minProperties,omitempty"`
+	MaxProperties    *int64   `json:"maxProperties,omitempty"`
+	KeyPattern       string   `json:"keyPattern,omitempty"`
+}
+
+// Position is the location of an annotation. Line and Column are 1-based.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (p Position) String() string {
+	return diag.Pos{File: p.File, Line: p.Line, Col: p.Column}.String()
+}
+
+func newModel(root *openapi.Node) *Model {
+	m := &Model{}
+	for _, n := range root.ByLine() {
+		switch {
+		case n.IsParam:
+			m.Params = append(m.Params, newParam(n))
+		case n.IsAlias():
+			m.Types = append(m.Types, &Type{
+				Name:        n.Name,
+				Kind:        Alias,
+				Description: n.Comment,
+				Doc:         n.Doc,
+				Base:        n.TypeExpr,
+				Constraints: constraints(n),
+				ListType:    n.ListType,
+				ListMapKeys: n.ListMapKeys,
+				Examples:    n.ExampleValues(),
+				Validations: validations(n),
+				Pos:         position(n.Pos),
+			})
+		case len(n.Enums) > 0 || n.TypeExpr != "struct":
+			m.Types = append(m.Types, &Type{
+				Name:        n.Name,
+				Kind:        Enum,
+				Description: n.Comment,
+				Doc:         n.Doc,
+				Base:        n.TypeExpr,
+				Values:      n.Enums,
+				Implicit:    n.Implicit,
+				Pos:         position(n.Pos),
+			})
+		default:
+			t := &Type{Name: n.Name, Kind: Struct, Description: n.Comment, Doc: n.Doc, Implicit: n.Implicit, Validations: validations(n), Discriminator: n.Discriminator, Pos: position(n.Pos)}
+			for _, v := range n.Variants {
+				t.Variants = append(t.Variants, Variant{Value: v.Value, Type: v.Type, Description: v.Description, Pos: position(v.Pos)})
+			}
+			for _, e := range n.Embeds {
+				t.Extends = append(t.Extends, e.Type)
+			}
+			for _, f := range n.ByLine() {
+				if f.Parent == n {
+					t.Fields = append(t.Fields, newParam(f))
+				}
+			}
+			m.Types = append(m.Types, t)
+		}
+	}
+	return m
+}
+
+func newParam(n *openapi.Node) *Param {
+	p := &Param{
+		Name:        n.Name,
+		Type:        n.TypeExpr,
+		Description: n.Comment,
+		Doc:         n.Doc,
+		Default:     n.DefaultVal,
+		HasDefault:  n.HasDefaultVal,
+		Optional:    n.OmitEmpty,
+		Required:    n.IsRequired(),
+		Immutable:   n.Immutable,
+		ListType:    n.ListType,
+		ListMapKeys: n.ListMapKeys,
+		Implicit:    n.Implicit,
+		Section:     n.Section,
+		Pos:         position(n.Pos),
+	}
+	p.Examples = n.ExampleValues()
+	p.Validations = validations(n)
+	if n.RequiredIf != nil {
+		p.RequiredIf = n.RequiredIf.String()
+	}
+	if n.VisibleIf != nil {
+		p.VisibleIf = n.VisibleIf.String()
+	}
+	p.Constraints = constraints(n)
+	return p
+}
+
+// constraints returns the validation constraints of n, or nil.
+func constraints(n *openapi.Node) *Constraints {
+	c := Constraints{
+		Minimum:          n.Minimum,
+		Maximum:          n.Maximum,
+		ExclusiveMinimum: n.ExclusiveMinimum,
+		ExclusiveMaximum: n.ExclusiveMaximum,
+		MinLength:        n.MinLength,
+		MaxLength:        n.MaxLength,
+		Pattern:          n.Pattern,
+		MinItems:         n.MinItems,
+		MaxItems:         n.MaxItems,
+		MinProperties:    n.MinProperties,
+		MaxProperties:    n.MaxProperties,
+		KeyPattern:       n.KeyPattern,
+	}
+	if c == (Constraints{}) {
+		return nil
+	}
+	return &c
+}
+
+// validations returns the @validate rules of n.
+func validations(n *openapi.Node) []Validation {
+	var out []Validation
+	for _, v := range n.Validations {
+		out = append(out, Validation{Rule: v.Rule, Message: v.Message})
+	}
+	return out
+}
+
+func position(p diag.Pos) Position {
+	return Position{File: p.File, Line: p.Line, Column: p.Col}
+}